@@ -32,11 +32,12 @@ var infoCmd = &cobra.Command{
 		if err != nil {
 			log.Error().Str("err", err.DebugReport()).Msg("cannot create CLI")
 		}
-		signupCli.Info(organizationID)
+		signupCli.Info(organizationID, detailed)
 	},
 }
 
 func init() {
 	infoCmd.Flags().StringVar(&organizationID, "organizationID", "", "Organization identifier")
+	infoCmd.Flags().BoolVar(&detailed, "detailed", false, "Include the clusters, descriptors and instances of the organization, and the number of users of each role")
 	rootCmd.AddCommand(infoCmd)
 }
@@ -32,10 +32,18 @@ var listCmd = &cobra.Command{
 		if err != nil {
 			log.Error().Str("err", err.DebugReport()).Msg("cannot create CLI")
 		}
-		signupCli.List()
+		signupCli.List(listOptions)
 	},
 }
 
 func init() {
+	listCmd.Flags().Int32Var(&listOptions.PageSize, "pageSize", 0, "Maximum number of organizations returned, all of them if 0")
+	listCmd.Flags().StringVar(&listOptions.PageToken, "pageToken", "", "Token of the page to retrieve, returned as nextPageToken by the previous page")
+	listCmd.Flags().StringVar(&listOptions.SortBy, "sortBy", "", "Sort the organizations by name, created, users, clusters or instances")
+	listCmd.Flags().BoolVar(&listOptions.Descending, "descending", false, "Sort the organizations in descending order")
+	listCmd.Flags().StringVar(&listOptions.NameFilter, "nameFilter", "", "Only list the organizations whose name contains this text")
+	listCmd.Flags().StringVar(&listOptions.CreatedAfter, "createdAfter", "", "Only list the organizations created at or after this RFC 3339 timestamp")
+	listCmd.Flags().StringVar(&listOptions.CreatedBefore, "createdBefore", "", "Only list the organizations created before this RFC 3339 timestamp")
+	listCmd.Flags().StringVar(&listOptions.HasClusters, "hasClusters", "", "Only list the organizations with (true) or without (false) clusters")
 	rootCmd.AddCommand(listCmd)
 }
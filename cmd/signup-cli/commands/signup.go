@@ -33,7 +33,7 @@ var signupCmd = &cobra.Command{
 			log.Fatal().Str("err", err.DebugReport()).Msg("cannot create CLI")
 			return
 		}
-		err = signupCli.SignupOrganization(orgName, orgEmail, orgFullAddress, orgCity, orgState, orgCountry, orgZipCode, orgPhotoPath,
+		err = signupCli.SignupOrganization(idempotencyKey, dryRun, plan, orgName, orgEmail, orgFullAddress, orgCity, orgState, orgCountry, orgZipCode, orgPhotoPath,
 			ownerEmail, ownerName, ownerLastName, ownerTitle, ownerPassword,
 			nalejAdminEmail, nalejAdminName, nalejAdminLastName, nalejAdminTitle, nalejAdminPassword)
 		if err != nil {
@@ -43,6 +43,10 @@ var signupCmd = &cobra.Command{
 }
 
 func init() {
+	signupCmd.Flags().StringVar(&plan, "plan", "", "Signup plan with the roles, settings and users of the organization, default plan if not set")
+	// Named dryRun instead of dry-run as every other flag of the CLI is camelCase.
+	signupCmd.Flags().BoolVar(&dryRun, "dryRun", false, "Validate the signup and print the planned organization, settings, roles and users without creating them")
+	signupCmd.Flags().StringVar(&idempotencyKey, "idempotencyKey", "", "Key to safely retry the signup without creating the organization twice")
 	addOrgFlags()
 	addOwnerFlags()
 	addNalejAdminFlags()
@@ -53,13 +57,16 @@ func init() {
 func addOrgFlags() {
 	signupCmd.Flags().StringVar(&orgName, "orgName", "", "Name of the organization")
 	_ = signupCmd.MarkFlagRequired("orgName")
-	// TODO orgEmail, orgAddress, orgCity, orgState, orgCountry, and orgZipCode must be marked as required when generation scripts are updated
+	// TODO orgEmail, orgAddress, orgCity and orgState must be marked as required when generation scripts are updated
 	signupCmd.Flags().StringVar(&orgEmail, "orgEmail", "unknown@unknown.com", "Email of the organization")
 	signupCmd.Flags().StringVar(&orgFullAddress, "orgAddress", "Unknown", "Organization full address")
 	signupCmd.Flags().StringVar(&orgCity, "orgCity", "Unknown", "Organization City")
 	signupCmd.Flags().StringVar(&orgState, "orgState", "Unknown", "Organization State")
-	signupCmd.Flags().StringVar(&orgCountry, "orgCountry", "Unknown", "Organization State")
-	signupCmd.Flags().StringVar(&orgZipCode, "orgZipCode", "Unknown", "Organization ZIP code")
+	// The country and the ZIP code are validated by the server, so there is no default value that could be accepted.
+	signupCmd.Flags().StringVar(&orgCountry, "orgCountry", "", "Organization country as an ISO 3166-1 alpha-2 code")
+	_ = signupCmd.MarkFlagRequired("orgCountry")
+	signupCmd.Flags().StringVar(&orgZipCode, "orgZipCode", "", "Organization ZIP code")
+	_ = signupCmd.MarkFlagRequired("orgZipCode")
 	signupCmd.Flags().StringVar(&orgPhotoPath, "orgPhotoPath", "", "Path of the organization photo/logo")
 }
 
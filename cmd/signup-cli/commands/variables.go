@@ -16,6 +16,8 @@
 
 package commands
 
+import "github.com/nalej/signup/internal/app/cli"
+
 var signupAddress string
 var caPath string
 var clientCertPath string
@@ -41,5 +43,10 @@ var nalejAdminLastName string
 var nalejAdminTitle string
 var nalejAdminPassword string
 var presharedSecret string
+var idempotencyKey string
+var dryRun bool
+var plan string
 
 var organizationID string
+var detailed bool
+var listOptions cli.ListOptions
@@ -17,7 +17,7 @@
 package commands
 
 import (
-	"io/ioutil"
+	"time"
 
 	"github.com/nalej/signup/internal/app/signup/server"
 	"github.com/rs/zerolog/log"
@@ -26,43 +26,82 @@ import (
 
 var config = server.Config{}
 
-var clientSecretPath string
-
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Launch the server API",
 	Long:  `Launch the server API`,
-	PreRun: func(cmd *cobra.Command, args []string) {
-		if config.UseTLS {
-			contents, err := ioutil.ReadFile(clientSecretPath)
-			if err != nil {
-				panic(err)
-			}
-			config.ClientSecret = string(contents)
-		}
-	},
 	Run: func(cmd *cobra.Command, args []string) {
 		SetupLogging()
 		log.Info().Msg("Launching API!")
 		server := server.NewService(config)
-		server.Run()
+		if err := server.Run(); err != nil {
+			log.Fatal().Err(err).Msg("service stopped with errors")
+		}
 	},
 }
 
 func init() {
 	runCmd.Flags().IntVar(&config.Port, "port", 8180, "Port to launch the Public gRPC API")
+	runCmd.Flags().IntVar(&config.HTTPPort, "httpPort", 8181, "Port to launch the HTTP gateway of the API")
+	runCmd.Flags().IntVar(&config.MetricsPort, "metricsPort", 8182, "Port to serve the Prometheus metrics, 0 to disable them")
+	runCmd.Flags().StringVar(&config.MetricsPath, "metricsPath", "/metrics", "HTTP path of the Prometheus metrics")
 	runCmd.Flags().BoolVar(&config.UseTLS, "tls", false, "Enable TLS for gRPC Service")
 	runCmd.Flags().StringVar(&config.CertCAPath, "caPath", "", "Absolute path to CA certificate")
 	runCmd.Flags().StringVar(&config.CertFilePath, "certFilePath", "", "Absolute path to certificate file")
 	runCmd.Flags().StringVar(&config.CertKeyPath, "certKeyPath", "", "Absolute path to certificate key")
-	runCmd.Flags().StringVar(&clientSecretPath, "clientSecretPath", "", "Absolute path to client certificate secret")
+	runCmd.Flags().StringVar(&config.ClientSecretPath, "clientSecretPath", "", "Absolute path to client certificate secret")
+	runCmd.Flags().DurationVar(&config.CredentialReloadInterval, "credentialReloadInterval", time.Minute,
+		"Period to reload the certificates and the client secret, 0 to disable it")
 	runCmd.PersistentFlags().StringVar(&config.SystemModelAddress, "systemModelAddress", "localhost:8800",
 		"System Model address (host:port)")
 	runCmd.PersistentFlags().StringVar(&config.UserManagerAddress, "userManagerAddress", "localhost:8920",
 		"User Manager address (host:port)")
 	runCmd.PersistentFlags().StringVar(&config.OrganizationManagerAddress, "organizationManagerAddress", "localhost:8950",
 		"User Manager address (host:port)")
+	addDependencyTLSFlags("systemModel", "System Model", &config.SystemModelTLS)
+	addDependencyTLSFlags("userManager", "User Manager", &config.UserManagerTLS)
+	addDependencyTLSFlags("organizationManager", "Organization Manager", &config.OrganizationManagerTLS)
+	runCmd.Flags().StringVar(&config.RoleCatalogPath, "roleCatalogPath", "", "Path of the YAML or JSON file with the roles created on every organization, default roles are used if not set")
+	runCmd.Flags().StringVar(&config.TemplateCatalogPath, "templateCatalogPath", "", "Path of the YAML or JSON file with the signup templates, the default template is used if not set")
+	runCmd.Flags().StringVar(&config.SignupRulesPath, "signupRulesPath", "", "Path of the YAML or JSON file with the rules applied to the fields of the signup requests, default rules are used if not set")
+	runCmd.Flags().IntVar(&config.PasswordPolicy.MinLength, "passwordMinLength", 8, "Minimum number of characters of the owner and Nalej admin passwords")
+	runCmd.Flags().IntVar(&config.PasswordPolicy.MaxLength, "passwordMaxLength", 128, "Maximum number of characters of the owner and Nalej admin passwords")
+	runCmd.Flags().BoolVar(&config.PasswordPolicy.RequireUppercase, "passwordRequireUppercase", true, "Require an uppercase letter in the passwords")
+	runCmd.Flags().BoolVar(&config.PasswordPolicy.RequireLowercase, "passwordRequireLowercase", true, "Require a lowercase letter in the passwords")
+	runCmd.Flags().BoolVar(&config.PasswordPolicy.RequireDigit, "passwordRequireDigit", true, "Require a digit in the passwords")
+	runCmd.Flags().BoolVar(&config.PasswordPolicy.RequireSymbol, "passwordRequireSymbol", false, "Require a symbol in the passwords")
+	runCmd.Flags().BoolVar(&config.PasswordPolicy.DisallowPersonalInfo, "passwordDisallowPersonalInfo", true, "Reject passwords that contain the email or the name of the user")
+	runCmd.Flags().StringVar(&config.PasswordPolicy.DenyListPath, "passwordDenyListPath", "", "Path of the file with the rejected passwords, one per line")
+	runCmd.Flags().IntVar(&config.SignupWorkers, "signupWorkers", 4, "Number of signup jobs executed concurrently")
+	runCmd.Flags().IntVar(&config.SignupQueueSize, "signupQueueSize", 100, "Maximum number of signup jobs waiting to be executed")
+	runCmd.Flags().DurationVar(&config.SignupJobTTL, "signupJobTTL", time.Hour, "Time the result of a signup job is kept once it has finished")
+	runCmd.Flags().IntVar(&config.ListConcurrency, "listConcurrency", 8, "Maximum number of organizations whose information is retrieved concurrently when listing organizations")
+	runCmd.Flags().DurationVar(&config.ResourceCacheTTL, "resourceCacheTTL", 30*time.Second, "Time the clusters, descriptors and instances of an organization are cached, 0 to disable the cache")
+	runCmd.Flags().IntVar(&config.ResourceCacheSize, "resourceCacheSize", 1000, "Maximum number of organizations whose clusters, descriptors and instances are cached")
+	runCmd.Flags().DurationVar(&config.IdempotencyTTL, "idempotencyTTL", 24*time.Hour, "Time the result of a signup is kept for its idempotency key")
+	runCmd.Flags().StringVar(&config.IdempotencyStorePath, "idempotencyStorePath", "", "Path of the file to persist the idempotency keys, kept in memory and lost on restart if not set")
+	runCmd.Flags().DurationVar(&config.ShutdownTimeout, "shutdownTimeout", 25*time.Second, "Maximum time to wait for in-flight requests on shutdown")
+	runCmd.PersistentFlags().DurationVar(&config.SystemModelTimeout, "systemModelTimeout", 10*time.Second,
+		"Maximum duration of the requests sent to System Model, 0 for no limit")
+	runCmd.PersistentFlags().DurationVar(&config.UserManagerTimeout, "userManagerTimeout", 10*time.Second,
+		"Maximum duration of the requests sent to User Manager, 0 for no limit")
+	runCmd.PersistentFlags().DurationVar(&config.OrganizationManagerTimeout, "organizationManagerTimeout", 10*time.Second,
+		"Maximum duration of the requests sent to Organization Manager, 0 for no limit")
 	runCmd.PersistentFlags().BoolVar(&config.UsePresharedSecret, "usePresharedSecret", false, "Use preshared secret to authenticate users")
 	runCmd.PersistentFlags().StringVar(&config.PresharedSecret, "presharedSecret", "changemeifyouareusingthis", "Preshared secret with the client")
 	rootCmd.AddCommand(runCmd)
 }
+
+// addDependencyTLSFlags adds the flags with the TLS configuration of the connection with a dependency.
+func addDependencyTLSFlags(prefix string, name string, dependencyTLS *server.DependencyTLS) {
+	runCmd.PersistentFlags().BoolVar(&dependencyTLS.UseTLS, prefix+"TLS", false,
+		"Use TLS to connect to "+name)
+	runCmd.PersistentFlags().StringVar(&dependencyTLS.CACertPath, prefix+"CAPath", "",
+		"Absolute path to the CA certificate used to verify "+name+", system CAs are used if not set")
+	runCmd.PersistentFlags().StringVar(&dependencyTLS.ClientCertPath, prefix+"ClientCertPath", "",
+		"Absolute path to the client certificate presented to "+name)
+	runCmd.PersistentFlags().StringVar(&dependencyTLS.ClientKeyPath, prefix+"ClientKeyPath", "",
+		"Absolute path to the client certificate key presented to "+name)
+	runCmd.PersistentFlags().StringVar(&dependencyTLS.ServerName, prefix+"ServerName", "",
+		"Server name used to verify the certificate of "+name)
+}
@@ -23,15 +23,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"strconv"
+	"time"
 
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-signup-go"
 	"github.com/nalej/grpc-utils/pkg/conversions"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+// IdempotencyKeyMetadataKey is the metadata key used to send the idempotency key of a signup.
+const IdempotencyKeyMetadataKey = "idempotency-key"
+
 //SignupCli with necessary data to create a new client
 type SignupCli struct {
 	client          grpc_signup_go.SignupClient
@@ -82,8 +90,11 @@ func NewSignupCli(signupAddress string, caPath string, clientCertPath string, cl
 	return &SignupCli{c, presharedSecret}, nil
 }
 
-//SignupOrganization sends the request to create a new Organization based on the arguments given
+//SignupOrganization sends the request to create a new Organization based on the arguments given. If the idempotency
+//key is not empty, retrying the signup with the same key returns the organization created by the first request. On
+//dry run, the plan of the signup is printed and nothing is created.
 func (s *SignupCli) SignupOrganization(
+	idempotencyKey string, dryRun bool, plan string,
 	orgName string, orgEmail string, orgFullAddress string, orgCity string, orgState string, orgCountry string, orgZipCode string,
 	orgPhotoPath string,
 	ownerEmail string, ownerName string, ownerLastName string, ownerTitle string, ownerPassword string,
@@ -115,18 +126,61 @@ func (s *SignupCli) SignupOrganization(
 		NalejadminLastName:      nalejAdminLastName,
 		NalejadminTitle:         nalejAdminTitle,
 		NalejadminPassword:      nalejAdminPassword,
+		DryRun:                  dryRun,
+		Plan:                    plan,
+	}
+	ctx := context.Background()
+	if idempotencyKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, IdempotencyKeyMetadataKey, idempotencyKey)
 	}
-	response, err := s.client.SignupOrganization(context.Background(), signupRequest)
+	response, err := s.client.SignupOrganization(ctx, signupRequest)
 	if err != nil {
 		dErr := conversions.ToDerror(err)
+		if printFieldViolations(err) {
+			return dErr
+		}
 		log.Error().Str("err", dErr.Error()).Msg("cannot signup organization")
 		log.Error().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("error")
-		return derr
+		return dErr
+	}
+	if dryRun {
+		_ = s.PrintResult(response.Plan)
+		return nil
+	}
+	log.Info().Str("organizationID", response.OrganizationId).
+		Strs("appliedSettings", response.AppliedSettings).Msg("organization has been added")
+	if len(response.FailedSettings) > 0 {
+		log.Warn().Strs("failedSettings", response.FailedSettings).Msg("some settings could not be applied")
+	}
+	// The response includes the identifiers of the roles indexed by name so users can be assigned afterwards.
+	if err := s.PrintResult(response); err != nil {
+		return derrors.AsError(err, "cannot print signup response")
 	}
-	log.Info().Str("organizationID", response.OrganizationId).Msg("organization has been added")
 	return nil
 }
 
+// printFieldViolations logs each invalid field of a request rejected by the server. It returns false if the error
+// does not contain field violations.
+func printFieldViolations(err error) bool {
+	st, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	found := false
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, violation := range badRequest.GetFieldViolations() {
+				log.Error().Str("field", violation.Field).Msg(violation.Description)
+				found = true
+			}
+		}
+	}
+	if found {
+		log.Error().Msg("the request contains invalid fields")
+	}
+	return found
+}
+
 func getTLSConfig(caPath string, clientCertPath string, clientKeyPath string) (credentials.TransportCredentials, derrors.Error) {
 	rootCAs := x509.NewCertPool()
 
@@ -151,19 +205,91 @@ func getTLSConfig(caPath string, clientCertPath string, clientKeyPath string) (c
 	return credentials.NewTLS(tlsConfig), nil
 }
 
-func (s *SignupCli) List() {
+// ListOptions contains the pagination, sorting and filtering options of the list of organizations.
+type ListOptions struct {
+	PageSize  int32
+	PageToken string
+	// SortBy is one of name, created, users, clusters or instances. The order of the server is kept if empty.
+	SortBy     string
+	Descending bool
+	NameFilter string
+	// CreatedAfter and CreatedBefore are RFC 3339 timestamps.
+	CreatedAfter  string
+	CreatedBefore string
+	// HasClusters is either true or false. Organizations are not filtered by their clusters if empty.
+	HasClusters string
+}
+
+// sortKeys contains the sort keys accepted by the CLI.
+var sortKeys = map[string]grpc_signup_go.OrganizationSortKey{
+	"":          grpc_signup_go.OrganizationSortKey_DEFAULT,
+	"name":      grpc_signup_go.OrganizationSortKey_NAME,
+	"created":   grpc_signup_go.OrganizationSortKey_CREATED,
+	"users":     grpc_signup_go.OrganizationSortKey_NUMBER_USERS,
+	"clusters":  grpc_signup_go.OrganizationSortKey_NUMBER_CLUSTERS,
+	"instances": grpc_signup_go.OrganizationSortKey_NUMBER_INSTANCES,
+}
+
+// toRequest builds the list request from the options.
+func (lo *ListOptions) toRequest(presharedSecret string) (*grpc_signup_go.SignupInfoRequest, derrors.Error) {
+	sortBy, found := sortKeys[lo.SortBy]
+	if !found {
+		return nil, derrors.NewInvalidArgumentError("sortBy must be one of name, created, users, clusters or instances").WithParams(lo.SortBy)
+	}
 	request := &grpc_signup_go.SignupInfoRequest{
-		PresharedSecret: s.PresharedSecret,
+		PresharedSecret: presharedSecret,
+		PageSize:        lo.PageSize,
+		PageToken:       lo.PageToken,
+		SortBy:          sortBy,
+		SortDescending:  lo.Descending,
+		NameFilter:      lo.NameFilter,
+	}
+	if lo.CreatedAfter != "" {
+		createdAfter, err := time.Parse(time.RFC3339, lo.CreatedAfter)
+		if err != nil {
+			return nil, derrors.AsError(err, "createdAfter must be a RFC 3339 timestamp")
+		}
+		request.CreatedAfter = createdAfter.Unix()
+	}
+	if lo.CreatedBefore != "" {
+		createdBefore, err := time.Parse(time.RFC3339, lo.CreatedBefore)
+		if err != nil {
+			return nil, derrors.AsError(err, "createdBefore must be a RFC 3339 timestamp")
+		}
+		request.CreatedBefore = createdBefore.Unix()
+	}
+	if lo.HasClusters != "" {
+		hasClusters, err := strconv.ParseBool(lo.HasClusters)
+		if err != nil {
+			return nil, derrors.AsError(err, "hasClusters must be true or false")
+		}
+		request.HasClusters = grpc_signup_go.ClusterFilter_WITHOUT_CLUSTERS
+		if hasClusters {
+			request.HasClusters = grpc_signup_go.ClusterFilter_WITH_CLUSTERS
+		}
+	}
+	return request, nil
+}
+
+func (s *SignupCli) List(options ListOptions) {
+	request, rErr := options.toRequest(s.PresharedSecret)
+	if rErr != nil {
+		log.Fatal().Str("trace", rErr.DebugReport()).Msg("invalid list options")
 	}
 	organizations, err := s.client.ListOrganizations(context.Background(), request)
 	s.PrintResultOrError(organizations, err, "cannot list organizations")
 }
 
-func (s *SignupCli) Info(organizationID string) {
+func (s *SignupCli) Info(organizationID string, detailed bool) {
 	request := &grpc_signup_go.SignupInfoRequest{
 		OrganizationId:  organizationID,
 		PresharedSecret: s.PresharedSecret,
 	}
+	if detailed {
+		info, err := s.client.GetOrganizationDetailedInfo(context.Background(), request)
+		s.PrintResultOrError(info, err, "cannot get organization detailed info")
+		return
+	}
 	info, err := s.client.GetOrganizationInfo(context.Background(), request)
 	s.PrintResultOrError(info, err, "cannot get organization info")
 }
@@ -18,6 +18,8 @@ package server
 
 import (
 	"context"
+	"crypto/x509"
+	"net/http"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
@@ -29,6 +31,8 @@ import (
 //AuthData deals with the certificate authentication process
 type AuthData struct {
 	ClientSecret string
+	// SecretSource returns the current client secret. If set, it takes precedence over ClientSecret.
+	SecretSource func() string
 }
 
 //Authenticate validates the client certificate in every gRPC request
@@ -43,13 +47,41 @@ func (a AuthData) Authenticate(ctx context.Context) (context.Context, error) {
 		return ctx, status.Error(codes.Unauthenticated, "unexpected peer credentials")
 	}
 
-	if len(tlsAuth.State.VerifiedChains) == 0 || len(tlsAuth.State.VerifiedChains[0]) == 0 {
-		return ctx, status.Error(codes.Unauthenticated, "invalid certificate")
+	return ctx, a.validateChains(tlsAuth.State.VerifiedChains)
+}
+
+//HTTPMiddleware validates the client certificate in every HTTP request before passing it to the next handler
+func (a AuthData) HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		if err := a.validateChains(r.TLS.VerifiedChains); err != nil {
+			http.Error(w, status.Convert(err).Message(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validateChains checks that the client certificate has been verified and contains the expected secret.
+func (a AuthData) validateChains(verifiedChains [][]*x509.Certificate) error {
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+		return status.Error(codes.Unauthenticated, "invalid certificate")
 	}
 
-	if tlsAuth.State.VerifiedChains[0][0].Subject.CommonName != a.ClientSecret {
-		return ctx, status.Error(codes.Unauthenticated, "invalid client certificate secret")
+	if verifiedChains[0][0].Subject.CommonName != a.clientSecret() {
+		return status.Error(codes.Unauthenticated, "invalid client certificate secret")
 	}
 
-	return ctx, nil
+	return nil
+}
+
+// clientSecret returns the client secret expected in the client certificates.
+func (a AuthData) clientSecret() string {
+	if a.SecretSource != nil {
+		return a.SecretSource()
+	}
+	return a.ClientSecret
 }
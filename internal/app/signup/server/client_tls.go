@@ -0,0 +1,109 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// DependencyTLS contains the TLS configuration used to connect to one of the components the signup depends on.
+type DependencyTLS struct {
+	// UseTLS if the connection uses TLS or not.
+	UseTLS bool
+	// CACertPath with the absolute path to the CA used to verify the server certificate. The system CAs are used if
+	// not set.
+	CACertPath string
+	// ClientCertPath with the absolute path to the client certificate presented for mTLS.
+	ClientCertPath string
+	// ClientKeyPath with the absolute path to the key of the client certificate.
+	ClientKeyPath string
+	// ServerName overrides the name used to verify the server certificate.
+	ServerName string
+}
+
+// Validate checks the TLS configuration of the dependency with the given name.
+func (dt *DependencyTLS) Validate(name string) derrors.Error {
+	if !dt.UseTLS {
+		if dt.CACertPath != "" || dt.ClientCertPath != "" || dt.ClientKeyPath != "" || dt.ServerName != "" {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("TLS options for %s require TLS to be enabled", name))
+		}
+		return nil
+	}
+	if (dt.ClientCertPath == "") != (dt.ClientKeyPath == "") {
+		return derrors.NewInvalidArgumentError(fmt.Sprintf("client certificate and key for %s must be set together", name))
+	}
+	_, err := dt.tlsConfig()
+	if err != nil {
+		return derrors.NewInvalidArgumentError(fmt.Sprintf("invalid TLS configuration for %s", name), err)
+	}
+	return nil
+}
+
+// DialOption returns the transport credentials used to connect to the dependency.
+func (dt *DependencyTLS) DialOption() (grpc.DialOption, derrors.Error) {
+	if !dt.UseTLS {
+		return grpc.WithInsecure(), nil
+	}
+	tlsConfig, err := dt.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)), nil
+}
+
+// Print outputs the TLS configuration of the dependency with the given name.
+func (dt *DependencyTLS) Print(name string) {
+	log.Info().Str("dependency", name).Bool("TLS", dt.UseTLS).Msg("Outgoing TLS enabled")
+	if dt.UseTLS {
+		log.Info().Str("dependency", name).Str("CA", dt.CACertPath).Str("cert", dt.ClientCertPath).
+			Str("key", dt.ClientKeyPath).Str("serverName", dt.ServerName).Msg("Outgoing TLS configuration")
+	}
+}
+
+// tlsConfig loads the CA and the client certificate of the dependency.
+func (dt *DependencyTLS) tlsConfig() (*tls.Config, derrors.Error) {
+	tlsConfig := &tls.Config{
+		ServerName: dt.ServerName,
+	}
+	if dt.CACertPath != "" {
+		caCert, err := ioutil.ReadFile(dt.CACertPath)
+		if err != nil {
+			return nil, derrors.AsError(err, "error loading CA certificate")
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caCert) {
+			return nil, derrors.NewInvalidArgumentError("CA certificate does not contain any valid certificate")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if dt.ClientCertPath != "" {
+		clientCert, err := tls.LoadX509KeyPair(dt.ClientCertPath, dt.ClientKeyPath)
+		if err != nil {
+			return nil, derrors.AsError(err, "error loading client certificate and key")
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+	return tlsConfig, nil
+}
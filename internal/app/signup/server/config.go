@@ -18,12 +18,12 @@ package server
 
 import (
 	"crypto/tls"
-	"crypto/x509"
-	"google.golang.org/grpc/credentials"
-	"io/ioutil"
 	"strings"
+	"time"
 
 	"github.com/nalej/derrors"
+	"github.com/nalej/signup/internal/app/signup/server/signup"
+	"github.com/nalej/signup/internal/pkg/entities"
 	"github.com/nalej/signup/version"
 	"github.com/rs/zerolog/log"
 )
@@ -34,12 +34,28 @@ type Config struct {
 	Port int
 	// HTTPPort where the HTTP gRPC gateway will be listening.
 	HTTPPort int
+	// MetricsPort where the Prometheus metrics will be served. Metrics are disabled if set to 0.
+	MetricsPort int
+	// MetricsPath with the HTTP path of the Prometheus metrics.
+	MetricsPath string
 	// SystemModelAddress with the host:port to connect to System Model
 	SystemModelAddress string
 	// UserManagerAddress with the host:port to connect to the User manager.
 	UserManagerAddress string
 	// OrganizationManagerAddress with the host:port to connect to the Organization manager.
 	OrganizationManagerAddress string
+	// SystemModelTimeout with the maximum duration of the requests sent to System Model.
+	SystemModelTimeout time.Duration
+	// UserManagerTimeout with the maximum duration of the requests sent to the User manager.
+	UserManagerTimeout time.Duration
+	// OrganizationManagerTimeout with the maximum duration of the requests sent to the Organization manager.
+	OrganizationManagerTimeout time.Duration
+	// SystemModelTLS with the TLS configuration of the connection with System Model.
+	SystemModelTLS DependencyTLS
+	// UserManagerTLS with the TLS configuration of the connection with the User manager.
+	UserManagerTLS DependencyTLS
+	// OrganizationManagerTLS with the TLS configuration of the connection with the Organization manager.
+	OrganizationManagerTLS DependencyTLS
 	// UseTLS if the gRPC service uses TLS or not
 	UseTLS bool
 	// CertCA with the absolute path to the certificate CA to trust
@@ -50,18 +66,71 @@ type Config struct {
 	CertKeyPath string
 	// ClientSecret with the client secret expected in client certificates
 	ClientSecret string
+	// ClientSecretPath with the absolute path to the file containing the client secret. If set, it takes precedence
+	// over ClientSecret.
+	ClientSecretPath string
+	// CredentialReloadInterval with the period to re-read the certificates and the client secret. Reloading is
+	// disabled if set to 0.
+	CredentialReloadInterval time.Duration
 
 	UsePresharedSecret bool
 	PresharedSecret    string
+
+	// RoleCatalogPath with the path of the YAML or JSON file containing the roles created on every organization. The
+	// default roles are used if not set.
+	RoleCatalogPath string
+	// TemplateCatalogPath with the path of the YAML or JSON file containing the signup templates. The default
+	// template is used if not set.
+	TemplateCatalogPath string
+
+	// SignupRulesPath with the path of the YAML or JSON file containing the rules applied to the fields of the signup
+	// requests. The default rules are used if not set.
+	SignupRulesPath string
+	// PasswordPolicy with the requirements of the passwords of the owner and the Nalej administrator.
+	PasswordPolicy entities.PasswordPolicy
+
+	// SignupWorkers with the number of signup jobs executed concurrently.
+	SignupWorkers int
+	// SignupQueueSize with the maximum number of signup jobs waiting to be executed.
+	SignupQueueSize int
+	// SignupJobTTL with the time the result of a signup job is kept once it has finished.
+	SignupJobTTL time.Duration
+
+	// ListConcurrency with the maximum number of organizations whose information is retrieved concurrently when
+	// listing organizations.
+	ListConcurrency int
+
+	// ResourceCacheTTL with the time the resources of an organization are cached. The cache is disabled if zero.
+	ResourceCacheTTL time.Duration
+	// ResourceCacheSize with the maximum number of organizations whose resources are cached.
+	ResourceCacheSize int
+
+	// IdempotencyTTL with the time the result of a signup is kept for its idempotency key.
+	IdempotencyTTL time.Duration
+	// IdempotencyStorePath with the path of the file where the idempotency keys are persisted. Keys are only kept
+	// in memory if not set, so they are lost on restart. In any case each replica has its own keys.
+	IdempotencyStorePath string
+
+	// ShutdownTimeout with the maximum time to wait for in-flight requests when the service is stopped. Signups that
+	// are rolled back may take up to signup.DefaultRollbackTimeout more.
+	ShutdownTimeout time.Duration
 }
 
 //Validate makes the necessary validation in configuration prior to its use
 func (conf *Config) Validate() derrors.Error {
 
-	if conf.Port <= 0 {
+	if conf.Port <= 0 || conf.HTTPPort <= 0 {
 		return derrors.NewInvalidArgumentError("ports must be valid")
 	}
 
+	if conf.MetricsPort < 0 {
+		return derrors.NewInvalidArgumentError("metricsPort must be valid")
+	}
+
+	if conf.MetricsPort > 0 && !strings.HasPrefix(conf.MetricsPath, "/") {
+		return derrors.NewInvalidArgumentError("metricsPath must start with /")
+	}
+
 	if conf.SystemModelAddress == "" {
 		return derrors.NewInvalidArgumentError("systemModelAddress must be set")
 	}
@@ -73,14 +142,57 @@ func (conf *Config) Validate() derrors.Error {
 	if conf.OrganizationManagerAddress == "" {
 		return derrors.NewInvalidArgumentError("organizationManagerAddress must be set")
 	}
+	if conf.SystemModelTimeout < 0 || conf.UserManagerTimeout < 0 || conf.OrganizationManagerTimeout < 0 {
+		return derrors.NewInvalidArgumentError("request timeouts cannot be negative")
+	}
+
 	if err := conf.validateTLS(); err != nil {
 		return err
 	}
 
+	if err := conf.SystemModelTLS.Validate("systemModel"); err != nil {
+		return err
+	}
+
+	if err := conf.UserManagerTLS.Validate("userManager"); err != nil {
+		return err
+	}
+
+	if err := conf.OrganizationManagerTLS.Validate("organizationManager"); err != nil {
+		return err
+	}
+
 	if conf.UsePresharedSecret && conf.PresharedSecret == "" {
 		return derrors.NewInvalidArgumentError("preshared secret must be set")
 	}
 
+	if err := conf.PasswordPolicy.Validate(); err != nil {
+		return err
+	}
+
+	if conf.SignupWorkers <= 0 || conf.SignupQueueSize < 0 || conf.SignupJobTTL <= 0 {
+		return derrors.NewInvalidArgumentError("signupWorkers and signupJobTTL must be positive, and signupQueueSize cannot be negative")
+	}
+
+	if conf.ListConcurrency <= 0 {
+		return derrors.NewInvalidArgumentError("listConcurrency must be positive")
+	}
+
+	if conf.ResourceCacheTTL < 0 {
+		return derrors.NewInvalidArgumentError("resourceCacheTTL cannot be negative")
+	}
+	if conf.ResourceCacheTTL > 0 && conf.ResourceCacheSize <= 0 {
+		return derrors.NewInvalidArgumentError("resourceCacheSize must be positive when the resource cache is enabled")
+	}
+
+	if conf.IdempotencyTTL <= 0 {
+		return derrors.NewInvalidArgumentError("idempotencyTTL must be positive")
+	}
+
+	if conf.ShutdownTimeout <= 0 {
+		return derrors.NewInvalidArgumentError("shutdownTimeout must be positive")
+	}
+
 	return nil
 }
 
@@ -89,21 +201,58 @@ func (conf *Config) Print() {
 	log.Info().Str("app", version.AppVersion).Str("commit", version.Commit).Msg("Version")
 	log.Info().Int("port", conf.Port).Msg("gRPC port")
 	log.Info().Int("port", conf.HTTPPort).Msg("HTTP port")
-	log.Info().Str("URL", conf.SystemModelAddress).Msg("System Model")
-	log.Info().Str("URL", conf.UserManagerAddress).Msg("User Manager")
-	log.Info().Str("URL", conf.OrganizationManagerAddress).Msg("Organization Manager")
+	if conf.MetricsPort > 0 {
+		log.Info().Int("port", conf.MetricsPort).Str("path", conf.MetricsPath).Msg("Metrics")
+	} else {
+		log.Info().Msg("Metrics disabled")
+	}
+	log.Info().Str("URL", conf.SystemModelAddress).Str("timeout", conf.SystemModelTimeout.String()).Msg("System Model")
+	log.Info().Str("URL", conf.UserManagerAddress).Str("timeout", conf.UserManagerTimeout.String()).Msg("User Manager")
+	log.Info().Str("URL", conf.OrganizationManagerAddress).Str("timeout", conf.OrganizationManagerTimeout.String()).Msg("Organization Manager")
+	conf.SystemModelTLS.Print("System Model")
+	conf.UserManagerTLS.Print("User Manager")
+	conf.OrganizationManagerTLS.Print("Organization Manager")
 
 	log.Info().Bool("TLS", conf.UseTLS).Msg("TLS Enabled")
 	if conf.UseTLS {
 		log.Info().Str("TLS", conf.CertCAPath).Msg("CA Certificate Path")
 		log.Info().Str("TLS", conf.CertFilePath).Msg("Server Certificate Path")
 		log.Info().Str("TLS", conf.CertKeyPath).Msg("Server Certificate Key Path")
-		log.Info().Str("TLS", strings.Repeat("*", len(conf.ClientSecret))).Msg("Client certificate secret")
+		log.Info().Str("TLS", conf.ClientSecretPath).Msg("Client certificate secret Path")
+		log.Info().Str("TLS", conf.CredentialReloadInterval.String()).Msg("Credential reload interval")
 	}
 	log.Info().Bool("enabled", conf.UsePresharedSecret).Msg("Use preshared secret")
 	if conf.UsePresharedSecret {
 		log.Info().Str("TLS", strings.Repeat("*", len(conf.PresharedSecret))).Msg("Preshared secret")
 	}
+	if conf.RoleCatalogPath != "" {
+		log.Info().Str("path", conf.RoleCatalogPath).Msg("Role catalog")
+	} else {
+		log.Info().Msg("Default role catalog")
+	}
+	if conf.TemplateCatalogPath != "" {
+		log.Info().Str("path", conf.TemplateCatalogPath).Msg("Template catalog")
+	} else {
+		log.Info().Msg("Default template catalog")
+	}
+	if conf.SignupRulesPath != "" {
+		log.Info().Str("path", conf.SignupRulesPath).Msg("Signup rules")
+	} else {
+		log.Info().Msg("Default signup rules")
+	}
+	policy := conf.PasswordPolicy
+	log.Info().Int("min", policy.MinLength).Int("max", policy.MaxLength).Bool("uppercase", policy.RequireUppercase).
+		Bool("lowercase", policy.RequireLowercase).Bool("digit", policy.RequireDigit).Bool("symbol", policy.RequireSymbol).
+		Bool("disallowPersonalInfo", policy.DisallowPersonalInfo).Str("denyList", policy.DenyListPath).Msg("Password policy")
+	log.Info().Int("workers", conf.SignupWorkers).Int("queue", conf.SignupQueueSize).Str("TTL", conf.SignupJobTTL.String()).Msg("Signup jobs")
+	log.Info().Int("concurrency", conf.ListConcurrency).Msg("List organizations")
+	if conf.ResourceCacheTTL > 0 {
+		log.Info().Str("TTL", conf.ResourceCacheTTL.String()).Int("size", conf.ResourceCacheSize).Msg("Resource cache")
+	} else {
+		log.Info().Msg("Resource cache disabled")
+	}
+	log.Info().Str("TTL", conf.IdempotencyTTL.String()).Str("path", conf.IdempotencyStorePath).Msg("Idempotency keys")
+	log.Info().Str("timeout", conf.ShutdownTimeout.String()).Msg("Shutdown timeout")
 
 }
 
@@ -115,36 +264,57 @@ func (conf *Config) validateTLS() derrors.Error {
 		if _, err := tls.LoadX509KeyPair(conf.CertFilePath, conf.CertKeyPath); err != nil {
 			return derrors.NewInvalidArgumentError("certFilePath or certKeyPath are invalid certificate file paths")
 		}
+		if conf.ClientSecretPath == "" && conf.ClientSecret == "" {
+			return derrors.NewInvalidArgumentError("if useTLS is enabled, clientSecretPath must be set")
+		}
+		if conf.CredentialReloadInterval < 0 {
+			return derrors.NewInvalidArgumentError("credentialReloadInterval cannot be negative")
+		}
 	}
 	return nil
 }
 
-//GetTLSConfig returns the necessary configuration with the CA and certificate files loaded if necessary
-func (conf *Config) GetTLSConfig() (credentials.TransportCredentials, derrors.Error) {
-	if conf.UseTLS {
-		rootCAs := x509.NewCertPool()
-
-		if conf.CertCAPath != "" {
-			caCert, err := ioutil.ReadFile(conf.CertCAPath)
-			if err != nil {
-				log.Fatal().Errs("error loading CA certificate: %v", []error{err})
-			}
-			rootCAs.AppendCertsFromPEM(caCert)
-		}
+// GetRoleCatalog returns the roles created on every organization, loading and validating the catalog file if set.
+func (conf *Config) GetRoleCatalog() (*signup.RoleCatalog, derrors.Error) {
+	if conf.RoleCatalogPath == "" {
+		return &signup.DefaultRoleCatalog, nil
+	}
+	return signup.LoadRoleCatalog(conf.RoleCatalogPath)
+}
 
-		serverCert, err := tls.LoadX509KeyPair(conf.CertFilePath, conf.CertKeyPath)
+// GetSignupRules returns the rules applied to the fields of the signup requests, loading the rules file if set, with
+// the configured password policy.
+func (conf *Config) GetSignupRules() (*entities.SignupRules, derrors.Error) {
+	var rules *entities.SignupRules
+	if conf.SignupRulesPath == "" {
+		rules = entities.DefaultSignupRules()
+		if err := rules.Validate(); err != nil {
+			return nil, err
+		}
+	} else {
+		loaded, err := entities.LoadSignupRules(conf.SignupRulesPath)
 		if err != nil {
-			log.Fatal().Errs("error loading Server certificate and key: %v", []error{err})
+			return nil, err
 		}
+		rules = loaded
+	}
+	policy := conf.PasswordPolicy
+	if err := policy.LoadDenyList(); err != nil {
+		return nil, err
+	}
+	rules.Password = &policy
+	return rules, nil
+}
 
-		tlsConfig := &tls.Config{
-			RootCAs:      rootCAs,
-			ClientCAs:    rootCAs,
-			ClientAuth:   tls.RequireAndVerifyClientCert,
-			Certificates: []tls.Certificate{serverCert},
+// GetTemplateCatalog returns the signup templates, loading the catalog file if set. The templates are validated
+// against the role catalog.
+func (conf *Config) GetTemplateCatalog(roles *signup.RoleCatalog) (*signup.TemplateCatalog, derrors.Error) {
+	if conf.TemplateCatalogPath == "" {
+		templates := &signup.DefaultTemplateCatalog
+		if err := templates.Validate(roles); err != nil {
+			return nil, err
 		}
-
-		return credentials.NewTLS(tlsConfig), nil
+		return templates, nil
 	}
-	return nil, derrors.NewGenericError("Requested TLS config without TLS enabled")
+	return signup.LoadTemplateCatalog(conf.TemplateCatalogPath, roles)
 }
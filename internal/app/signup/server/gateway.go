@@ -0,0 +1,130 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-signup-go"
+	"github.com/nalej/signup/internal/app/signup/server/signup"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// PresharedSecretHeader is the HTTP header used to send the preshared secret to the HTTP gateway.
+const PresharedSecretHeader = "X-Preshared-Secret"
+
+// IdempotencyKeyHeader is the HTTP header used to send the idempotency key of a signup to the HTTP gateway.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// gatewayBufferSize is the size of the in-memory connection between the HTTP gateway and the gRPC handler.
+const gatewayBufferSize = 1024 * 1024
+
+// gatewayHeaderMatcher forwards the preshared secret and idempotency key headers as gRPC metadata along with the
+// default headers.
+func gatewayHeaderMatcher(key string) (string, bool) {
+	switch textproto.CanonicalMIMEHeaderKey(key) {
+	case PresharedSecretHeader:
+		return signup.PresharedSecretMetadataKey, true
+	case IdempotencyKeyHeader:
+		return signup.IdempotencyKeyMetadataKey, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// newGatewayConnection serves the handler on an in-memory gRPC server and returns a connection to it. Client
+// certificates are verified by the HTTP server, so the in-memory server only applies the common interceptors.
+func (s *Service) newGatewayConnection() (*grpc.ClientConn, derrors.Error) {
+	listener := bufconn.Listen(gatewayBufferSize)
+	s.gatewayServer = grpc.NewServer(
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unaryInterceptors()...)),
+		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(streamInterceptors()...)),
+	)
+	grpc_signup_go.RegisterSignupServer(s.gatewayServer, s.handler)
+	go func() {
+		if err := s.gatewayServer.Serve(listener); err != nil {
+			s.serveErrors <- derrors.AsError(err, "failed to serve gateway gRPC server")
+		}
+	}()
+	conn, err := grpc.Dial("gateway", grpc.WithInsecure(), grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot create gateway connection")
+	}
+	return conn, nil
+}
+
+//LaunchHTTP creates the HTTP gateway of the gRPC API and serves it in background
+func (s *Service) LaunchHTTP() derrors.Error {
+	conn, cErr := s.newGatewayConnection()
+	if cErr != nil {
+		return cErr
+	}
+	mux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(gatewayHeaderMatcher))
+	if err := grpc_signup_go.RegisterSignupHandler(context.Background(), mux, conn); err != nil {
+		return derrors.AsError(err, "failed to register signup gateway")
+	}
+
+	var gateway http.Handler = mux
+	var tlsConfig *tls.Config
+	if s.Configuration.UseTLS {
+		tlsConfig = s.credentials.HTTPTLSConfig()
+		authData := AuthData{
+			SecretSource: s.credentials.ClientSecret,
+		}
+		gateway = authData.HTTPMiddleware(mux)
+	}
+
+	// Health endpoints are not authenticated so they can be used by the orchestrator probes.
+	httpMux := http.NewServeMux()
+	httpMux.HandleFunc("/healthz", s.dependencies.LivenessHandler)
+	httpMux.HandleFunc("/readyz", s.dependencies.ReadinessHandler)
+	httpMux.Handle("/", gateway)
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Configuration.HTTPPort))
+	if err != nil {
+		return derrors.AsError(err, "failed to listen on HTTP port")
+	}
+	s.httpServer = &http.Server{
+		Handler:   httpMux,
+		TLSConfig: tlsConfig,
+	}
+	log.Info().Int("port", s.Configuration.HTTPPort).Msg("Launching HTTP gateway")
+	go func() {
+		var err error
+		if s.Configuration.UseTLS {
+			err = s.httpServer.ServeTLS(lis, "", "")
+		} else {
+			err = s.httpServer.Serve(lis)
+		}
+		if err != http.ErrServerClosed {
+			s.serveErrors <- derrors.AsError(err, "failed to serve HTTP gateway")
+		}
+	}()
+	return nil
+}
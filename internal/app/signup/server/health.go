@@ -0,0 +1,157 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// SignupServiceName is the name of the signup service reported by the gRPC health service.
+const SignupServiceName = "signup.Signup"
+
+// DependencyMonitor tracks the connectivity state of the connections with the components the signup depends on,
+// and publishes the resulting readiness on the gRPC health service.
+type DependencyMonitor struct {
+	sync.RWMutex
+	states map[string]connectivity.State
+	// connected contains the dependencies whose connection has been ready at least once.
+	connected    map[string]bool
+	healthServer *health.Server
+}
+
+// NewDependencyMonitor creates a monitor that publishes the readiness on the given health server.
+func NewDependencyMonitor(healthServer *health.Server) *DependencyMonitor {
+	return &DependencyMonitor{
+		states:       make(map[string]connectivity.State, 0),
+		connected:    make(map[string]bool, 0),
+		healthServer: healthServer,
+	}
+}
+
+// isAvailable checks if a connection in the given state can be used. Idle connections reconnect on demand, but
+// they are only considered available once they have connected.
+func isAvailable(state connectivity.State, connected bool) bool {
+	return state == connectivity.Ready || (state == connectivity.Idle && connected)
+}
+
+// connector is implemented by the connections that can leave the idle state on request.
+type connector interface {
+	Connect()
+}
+
+// connect starts the connection of an idle connection, if supported.
+func connect(conn *grpc.ClientConn, state connectivity.State) {
+	if c, ok := interface{}(conn).(connector); ok && state == connectivity.Idle {
+		c.Connect()
+	}
+}
+
+// Watch follows the state of a connection until the context is done. Idle connections are asked to connect.
+func (dm *DependencyMonitor) Watch(ctx context.Context, name string, conn *grpc.ClientConn) {
+	state := conn.GetState()
+	dm.update(name, state)
+	connect(conn, state)
+	go func() {
+		for conn.WaitForStateChange(ctx, state) {
+			state = conn.GetState()
+			dm.update(name, state)
+			connect(conn, state)
+		}
+	}()
+}
+
+// update records the new state of a connection and refreshes the health status.
+func (dm *DependencyMonitor) update(name string, state connectivity.State) {
+	dm.Lock()
+	previous, found := dm.states[name]
+	wasConnected := dm.connected[name]
+	dm.states[name] = state
+	if state == connectivity.Ready {
+		dm.connected[name] = true
+	}
+	connected := dm.connected[name]
+	dm.Unlock()
+
+	if !found || isAvailable(previous, wasConnected) != isAvailable(state, connected) {
+		log.Info().Str("dependency", name).Str("state", state.String()).Msg("dependency availability changed")
+	} else {
+		log.Debug().Str("dependency", name).Str("state", state.String()).Msg("dependency state changed")
+	}
+
+	servingStatus := grpc_health_v1.HealthCheckResponse_SERVING
+	if ready, _ := dm.Ready(); !ready {
+		servingStatus = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	}
+	dm.healthServer.SetServingStatus("", servingStatus)
+	dm.healthServer.SetServingStatus(SignupServiceName, servingStatus)
+}
+
+// Ready checks if all the dependencies are available. It also returns the state of each dependency.
+func (dm *DependencyMonitor) Ready() (bool, map[string]string) {
+	dm.RLock()
+	defer dm.RUnlock()
+	ready := true
+	states := make(map[string]string, len(dm.states))
+	for name, state := range dm.states {
+		states[name] = state.String()
+		if !isAvailable(state, dm.connected[name]) {
+			ready = false
+		}
+	}
+	return ready, states
+}
+
+// healthService exposes the gRPC health service without client authentication, so it can be used by the
+// orchestrator probes.
+type healthService struct {
+	*health.Server
+}
+
+// AuthFuncOverride skips the authentication of the health checks.
+func (hs healthService) AuthFuncOverride(ctx context.Context, fullMethodName string) (context.Context, error) {
+	return ctx, nil
+}
+
+// LivenessHandler reports that the process is alive.
+func (dm *DependencyMonitor) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// ReadinessHandler reports whether the service can process requests, including the state of each dependency.
+func (dm *DependencyMonitor) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	ready, states := dm.Ready()
+	w.Header().Set("Content-Type", "application/json")
+	if ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"ready":        ready,
+		"dependencies": states,
+	})
+}
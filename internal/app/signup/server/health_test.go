@@ -0,0 +1,90 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+var _ = ginkgo.Describe("Health checks", func() {
+
+	var healthServer *health.Server
+	var monitor *DependencyMonitor
+
+	// servingStatus returns the status of the signup service published on the health server.
+	servingStatus := func() grpc_health_v1.HealthCheckResponse_ServingStatus {
+		response, err := healthServer.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: SignupServiceName})
+		gomega.Expect(err).To(gomega.Succeed())
+		return response.Status
+	}
+
+	ginkgo.BeforeEach(func() {
+		healthServer = health.NewServer()
+		monitor = NewDependencyMonitor(healthServer)
+	})
+
+	ginkgo.It("should not be ready until every dependency has connected", func() {
+		monitor.update("user-manager", connectivity.Ready)
+		monitor.update("organization-manager", connectivity.Idle)
+		ready, _ := monitor.Ready()
+		gomega.Expect(ready).To(gomega.BeFalse())
+		gomega.Expect(servingStatus()).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING))
+
+		monitor.update("organization-manager", connectivity.Connecting)
+		monitor.update("organization-manager", connectivity.Ready)
+		ready, _ = monitor.Ready()
+		gomega.Expect(ready).To(gomega.BeTrue())
+		gomega.Expect(servingStatus()).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_SERVING))
+	})
+
+	ginkgo.It("should keep idle dependencies that have connected as ready", func() {
+		monitor.update("user-manager", connectivity.Ready)
+		monitor.update("user-manager", connectivity.Idle)
+		ready, _ := monitor.Ready()
+		gomega.Expect(ready).To(gomega.BeTrue())
+
+		monitor.update("user-manager", connectivity.TransientFailure)
+		ready, states := monitor.Ready()
+		gomega.Expect(ready).To(gomega.BeFalse())
+		gomega.Expect(states).To(gomega.HaveKeyWithValue("user-manager", connectivity.TransientFailure.String()))
+	})
+
+	ginkgo.It("should not authenticate the health service", func() {
+		interceptor := grpc_auth.UnaryServerInterceptor(AuthData{ClientSecret: "secret"}.Authenticate)
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return "handled", nil
+		}
+		response, err := interceptor(context.Background(), nil,
+			&grpc.UnaryServerInfo{Server: healthService{healthServer}, FullMethod: "/grpc.health.v1.Health/Check"}, handler)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(response).To(gomega.Equal("handled"))
+
+		_, err = interceptor(context.Background(), nil,
+			&grpc.UnaryServerInfo{Server: healthServer, FullMethod: "/signup.Signup/SignupOrganization"}, handler)
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unauthenticated))
+	})
+})
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"runtime/debug"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/nalej/signup/internal/app/signup/server/metrics"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newCorrelationID generates a random identifier used to match the error returned to the client with the logs.
+func newCorrelationID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// recoveryHandler converts a panic on a gRPC handler into an Internal error. The panic and its stack trace are
+// logged with a correlation identifier that is also sent to the client.
+func recoveryHandler(p interface{}) error {
+	correlationID := newCorrelationID()
+	log.Error().Str("correlationID", correlationID).Interface("panic", p).Str("stack", string(debug.Stack())).
+		Msg("recovered from panic in gRPC handler")
+	return status.Errorf(codes.Internal, "internal error, correlation id: %s", correlationID)
+}
+
+// statusError is implemented by the errors that provide their own gRPC status, such as validation errors with
+// BadRequest details.
+type statusError interface {
+	GRPCStatus() *status.Status
+}
+
+// toGRPCError converts derrors.Error values into gRPC status errors. Errors that provide their own status and other
+// errors are returned unchanged.
+func toGRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(statusError); ok {
+		return err
+	}
+	if dErr, ok := err.(derrors.Error); ok {
+		return conversions.ToGRPCError(dErr)
+	}
+	return err
+}
+
+// errorMappingUnaryInterceptor maps the errors returned by unary handlers to gRPC status codes.
+func errorMappingUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	return resp, toGRPCError(err)
+}
+
+// errorMappingStreamInterceptor maps the errors returned by stream handlers to gRPC status codes.
+func errorMappingStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return toGRPCError(handler(srv, ss))
+}
+
+// unaryInterceptors returns the interceptors applied to every unary call. Metrics are the outermost ones to
+// record recovered panics, followed by panic recovery so that panics in any other interceptor are also recovered.
+func unaryInterceptors() []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{
+		metrics.UnaryServerInterceptor,
+		grpc_recovery.UnaryServerInterceptor(grpc_recovery.WithRecoveryHandler(recoveryHandler)),
+		errorMappingUnaryInterceptor,
+	}
+}
+
+// streamInterceptors returns the interceptors applied to every stream call.
+func streamInterceptors() []grpc.StreamServerInterceptor {
+	return []grpc.StreamServerInterceptor{
+		metrics.StreamServerInterceptor,
+		grpc_recovery.StreamServerInterceptor(grpc_recovery.WithRecoveryHandler(recoveryHandler)),
+		errorMappingStreamInterceptor,
+	}
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metrics contains the Prometheus metrics exposed by the signup component.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "signup"
+
+var (
+	// rpcRequests counts the requests received by the gRPC server.
+	rpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_requests_total",
+		Help:      "Number of gRPC requests received by method and status code",
+	}, []string{"method", "code"})
+	// rpcDuration measures the time spent serving gRPC requests.
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Time spent serving gRPC requests by method",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+	// signups counts the organization signups by result.
+	signups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "organizations_total",
+		Help:      "Number of organization signups by result",
+	}, []string{"result"})
+	// stepDuration measures the time spent on each signup step.
+	stepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "step_duration_seconds",
+		Help:      "Time spent on each signup step",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"step"})
+	// stepFailures counts the failed signup steps.
+	stepFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "step_failures_total",
+		Help:      "Number of failures by signup step",
+	}, []string{"step"})
+	// rollbacks counts the rollbacks of failed signups by result.
+	rollbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rollbacks_total",
+		Help:      "Number of rollbacks of failed signups by result",
+	}, []string{"result"})
+	// downstreamRequests counts the requests sent to other components.
+	downstreamRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downstream_requests_total",
+		Help:      "Number of requests sent to other components by method and status code",
+	}, []string{"method", "code"})
+	// downstreamDuration measures the time spent waiting for other components.
+	downstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "downstream_duration_seconds",
+		Help:      "Time spent on requests sent to other components by method",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+	// credentialReloads counts the reloads of the server certificates and client secret by result.
+	credentialReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "credential_reloads_total",
+		Help:      "Number of reloads of the server certificates and client secret by result",
+	}, []string{"result"})
+	// cacheLookups counts the lookups of the organization resources cache by result.
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resource_cache_lookups_total",
+		Help:      "Number of lookups of the organization resources cache by result",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(rpcRequests, rpcDuration, signups, stepDuration, stepFailures, rollbacks,
+		downstreamRequests, downstreamDuration, credentialReloads, cacheLookups)
+}
+
+// methodName removes the leading slash of a gRPC full method name.
+func methodName(fullMethod string) string {
+	return strings.TrimPrefix(fullMethod, "/")
+}
+
+// resultLabel returns the label of an operation depending on its error.
+func resultLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// ObserveRPC records a request served by the gRPC server.
+func ObserveRPC(fullMethod string, start time.Time, err error) {
+	method := methodName(fullMethod)
+	rpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	rpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// ObserveSignup records the result of an organization signup.
+func ObserveSignup(err error) {
+	signups.WithLabelValues(resultLabel(err)).Inc()
+}
+
+// ObserveStep records the duration of a signup step, and its failure if any.
+func ObserveStep(step string, start time.Time, err error) {
+	stepDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+	if err != nil {
+		stepFailures.WithLabelValues(step).Inc()
+	}
+}
+
+// ObserveRollback records the result of the rollback of a failed signup.
+func ObserveRollback(completed bool) {
+	if completed {
+		rollbacks.WithLabelValues("completed").Inc()
+	} else {
+		rollbacks.WithLabelValues("incomplete").Inc()
+	}
+}
+
+// ObserveCredentialReload records the result of reloading the server certificates and client secret.
+func ObserveCredentialReload(err error) {
+	credentialReloads.WithLabelValues(resultLabel(err)).Inc()
+}
+
+// ObserveCacheLookup records a hit or a miss of the organization resources cache.
+func ObserveCacheLookup(hit bool) {
+	if hit {
+		cacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		cacheLookups.WithLabelValues("miss").Inc()
+	}
+}
+
+// UnaryServerInterceptor records the requests served by the gRPC server.
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	ObserveRPC(info.FullMethod, start, err)
+	return resp, err
+}
+
+// StreamServerInterceptor records the streams served by the gRPC server.
+func StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	ObserveRPC(info.FullMethod, start, err)
+	return err
+}
+
+// UnaryClientInterceptor records the requests sent to other components.
+func UnaryClientInterceptor(ctx context.Context, fullMethod string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, fullMethod, req, reply, cc, opts...)
+	method := methodName(fullMethod)
+	downstreamRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	downstreamDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// Handler returns the HTTP handler that exposes the metrics.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
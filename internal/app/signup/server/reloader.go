@@ -0,0 +1,199 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/signup/internal/app/signup/server/metrics"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/credentials"
+)
+
+// credentialFiles contains the raw contents of the files with the server credentials.
+type credentialFiles struct {
+	ca           []byte
+	cert         []byte
+	key          []byte
+	clientSecret []byte
+}
+
+// equal checks if the contents of the files have not changed.
+func (cf *credentialFiles) equal(other *credentialFiles) bool {
+	return bytes.Equal(cf.ca, other.ca) && bytes.Equal(cf.cert, other.cert) &&
+		bytes.Equal(cf.key, other.key) && bytes.Equal(cf.clientSecret, other.clientSecret)
+}
+
+// CredentialReloader holds the server certificate, the CA used to verify the client certificates and the expected
+// client secret. The files are periodically re-read so rotated credentials are used without restarting the service.
+type CredentialReloader struct {
+	sync.RWMutex
+	caPath           string
+	certPath         string
+	keyPath          string
+	clientSecretPath string
+	files            *credentialFiles
+	certificate      *tls.Certificate
+	clientCAs        *x509.CertPool
+	clientSecret     string
+}
+
+// NewCredentialReloader creates a reloader with the credentials of the configuration loaded.
+func NewCredentialReloader(conf Config) (*CredentialReloader, derrors.Error) {
+	reloader := &CredentialReloader{
+		caPath:           conf.CertCAPath,
+		certPath:         conf.CertFilePath,
+		keyPath:          conf.CertKeyPath,
+		clientSecretPath: conf.ClientSecretPath,
+		clientSecret:     conf.ClientSecret,
+	}
+	if _, err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload re-reads the credential files and replaces the current credentials if they have changed. The current
+// credentials are kept if the new ones cannot be loaded.
+func (cr *CredentialReloader) Reload() (bool, derrors.Error) {
+	files, err := cr.readFiles()
+	if err != nil {
+		return false, err
+	}
+	cr.RLock()
+	unchanged := cr.files != nil && cr.files.equal(files)
+	cr.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	certificate, tErr := tls.X509KeyPair(files.cert, files.key)
+	if tErr != nil {
+		return false, derrors.AsError(tErr, "error loading Server certificate and key")
+	}
+	clientCAs := x509.NewCertPool()
+	if files.ca != nil && !clientCAs.AppendCertsFromPEM(files.ca) {
+		return false, derrors.NewInvalidArgumentError("CA certificate does not contain any valid certificate")
+	}
+
+	cr.Lock()
+	defer cr.Unlock()
+	cr.files = files
+	cr.certificate = &certificate
+	cr.clientCAs = clientCAs
+	if files.clientSecret != nil {
+		cr.clientSecret = string(files.clientSecret)
+	}
+	return true, nil
+}
+
+// readFiles reads the current contents of the credential files.
+func (cr *CredentialReloader) readFiles() (*credentialFiles, derrors.Error) {
+	files := &credentialFiles{}
+	var err error
+	if cr.caPath != "" {
+		if files.ca, err = ioutil.ReadFile(cr.caPath); err != nil {
+			return nil, derrors.AsError(err, "error loading CA certificate")
+		}
+	}
+	if files.cert, err = ioutil.ReadFile(cr.certPath); err != nil {
+		return nil, derrors.AsError(err, "error loading Server certificate")
+	}
+	if files.key, err = ioutil.ReadFile(cr.keyPath); err != nil {
+		return nil, derrors.AsError(err, "error loading Server certificate key")
+	}
+	if cr.clientSecretPath != "" {
+		if files.clientSecret, err = ioutil.ReadFile(cr.clientSecretPath); err != nil {
+			return nil, derrors.AsError(err, "error loading client certificate secret")
+		}
+	}
+	return files, nil
+}
+
+// Watch reloads the credentials every interval until the context is done.
+func (cr *CredentialReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := cr.Reload()
+			if err != nil {
+				metrics.ObserveCredentialReload(err)
+				log.Error().Str("trace", err.DebugReport()).Msg("cannot reload credentials, keeping the current ones")
+				continue
+			}
+			if reloaded {
+				metrics.ObserveCredentialReload(nil)
+				log.Info().Str("certificate", cr.certPath).Msg("credentials have been reloaded")
+			}
+		}
+	}
+}
+
+// ClientSecret returns the current client secret.
+func (cr *CredentialReloader) ClientSecret() string {
+	cr.RLock()
+	defer cr.RUnlock()
+	return cr.clientSecret
+}
+
+// GetCertificate returns the current server certificate.
+func (cr *CredentialReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.RLock()
+	defer cr.RUnlock()
+	return cr.certificate, nil
+}
+
+// TLSConfig returns a server TLS configuration that uses the current certificate and CA on every handshake.
+func (cr *CredentialReloader) TLSConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		GetCertificate: cr.GetCertificate,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cr.RLock()
+			defer cr.RUnlock()
+			return &tls.Config{
+				Certificates: []tls.Certificate{*cr.certificate},
+				ClientCAs:    cr.clientCAs,
+				ClientAuth:   clientAuth,
+				NextProtos:   []string{"h2", "http/1.1"},
+			}, nil
+		},
+		ClientAuth: clientAuth,
+	}
+}
+
+// GRPCCredentials returns the transport credentials of the gRPC server. Client certificates are verified if present,
+// and their presence is enforced on every service except health checks by AuthData.Authenticate.
+func (cr *CredentialReloader) GRPCCredentials() credentials.TransportCredentials {
+	return credentials.NewTLS(cr.TLSConfig(tls.VerifyClientCertIfGiven))
+}
+
+// HTTPTLSConfig returns the TLS configuration of the HTTP server. Client certificates are verified if present, and
+// their presence is enforced per endpoint by AuthData.HTTPMiddleware.
+func (cr *CredentialReloader) HTTPTLSConfig() *tls.Config {
+	return cr.TLSConfig(tls.VerifyClientCertIfGiven)
+}
@@ -17,31 +17,55 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"github.com/nalej/grpc-application-go"
 	"github.com/nalej/grpc-infrastructure-go"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/grpc-ecosystem/go-grpc-middleware/auth"
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-organization-manager-go"
 	"github.com/nalej/grpc-signup-go"
 	"github.com/nalej/grpc-user-manager-go"
+	"github.com/nalej/signup/internal/app/signup/server/metrics"
 	"github.com/nalej/signup/internal/app/signup/server/signup"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
 //Service struct to define the gRPC Server and its configuration
 type Service struct {
 	Configuration Config
+	clients       *Clients
+	handler       *signup.Handler
+	healthServer  *health.Server
+	// credentials contains the server certificates and client secret when TLS is enabled.
+	credentials  *CredentialReloader
+	dependencies *DependencyMonitor
+	// stopWatching stops the monitoring of the dependencies.
+	stopWatching context.CancelFunc
+	grpcServer   *grpc.Server
+	// gatewayServer is the in-memory gRPC server used by the HTTP gateway.
+	gatewayServer *grpc.Server
+	httpServer    *http.Server
+	metricsServer *http.Server
+	// serveErrors receives the errors of the servers running in background.
+	serveErrors chan error
 }
 
 // NewService creates a new system model service.
 func NewService(conf Config) *Service {
 	return &Service{
-		conf,
+		Configuration: conf,
 	}
 }
 
@@ -50,22 +74,25 @@ type Clients struct {
 	orgClient     grpc_organization_manager_go.OrganizationsClient
 	userClient    grpc_user_manager_go.UserManagerClient
 	clusterClient grpc_infrastructure_go.ClustersClient
+	nodeClient    grpc_infrastructure_go.NodesClient
 	appClient     grpc_application_go.ApplicationsClient
+	// connections contains the underlying connections indexed by dependency name.
+	connections map[string]*grpc.ClientConn
 }
 
 //GetClients gets a new instance of Clients with an active client of every type defined
 func (s *Service) GetClients() (*Clients, derrors.Error) {
-	smConn, err := grpc.Dial(s.Configuration.SystemModelAddress, grpc.WithInsecure())
+	smConn, err := dial(s.Configuration.SystemModelAddress, s.Configuration.SystemModelTLS)
 	if err != nil {
 		return nil, derrors.AsError(err, "cannot create connection with the system model")
 	}
 
-	uConn, err := grpc.Dial(s.Configuration.UserManagerAddress, grpc.WithInsecure())
+	uConn, err := dial(s.Configuration.UserManagerAddress, s.Configuration.UserManagerTLS)
 	if err != nil {
 		return nil, derrors.AsError(err, "cannot create connection with the user manager")
 	}
 
-	orgConn, err := grpc.Dial(s.Configuration.OrganizationManagerAddress, grpc.WithInsecure())
+	orgConn, err := dial(s.Configuration.OrganizationManagerAddress, s.Configuration.OrganizationManagerTLS)
 	if err != nil {
 		return nil, derrors.AsError(err, "cannot create connection with the organization manager")
 	}
@@ -73,65 +100,187 @@ func (s *Service) GetClients() (*Clients, derrors.Error) {
 	oClient := grpc_organization_manager_go.NewOrganizationsClient(orgConn)
 	uClient := grpc_user_manager_go.NewUserManagerClient(uConn)
 	cClient := grpc_infrastructure_go.NewClustersClient(smConn)
+	nClient := grpc_infrastructure_go.NewNodesClient(smConn)
 	aClient := grpc_application_go.NewApplicationsClient(smConn)
-	log.Debug().Str("smConn", smConn.GetState().String()).Str("uConn", uConn.GetState().String()).Msg("connections have been created")
+	log.Debug().Str("smConn", smConn.GetState().String()).Str("uConn", uConn.GetState().String()).
+		Str("orgConn", orgConn.GetState().String()).Msg("connections have been created")
 
-	return &Clients{oClient, uClient, cClient, aClient}, nil
+	connections := map[string]*grpc.ClientConn{
+		"system-model":         smConn,
+		"user-manager":         uConn,
+		"organization-manager": orgConn,
+	}
+	return &Clients{oClient, uClient, cClient, nClient, aClient, connections}, nil
+}
+
+// dial creates the connection with a dependency using its TLS configuration.
+func dial(address string, dependencyTLS DependencyTLS) (*grpc.ClientConn, error) {
+	transport, err := dependencyTLS.DialOption()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Dial(address, transport, grpc.WithUnaryInterceptor(metrics.UnaryClientInterceptor))
 }
 
-// Run the service, launch the REST service handler.
+// Run the service, launch the gRPC, HTTP and metrics servers and wait until a shutdown is requested.
 func (s *Service) Run() error {
 	vErr := s.Configuration.Validate()
 	if vErr != nil {
-		log.Fatal().Str("err", vErr.DebugReport()).Msg("invalid configuration")
+		log.Error().Str("err", vErr.DebugReport()).Msg("invalid configuration")
+		return vErr
 	}
 
 	s.Configuration.Print()
 
-	return s.LaunchGRPC()
-}
+	roles, rErr := s.Configuration.GetRoleCatalog()
+	if rErr != nil {
+		log.Error().Str("err", rErr.DebugReport()).Msg("invalid role catalog")
+		return rErr
+	}
+	templates, tErr := s.Configuration.GetTemplateCatalog(roles)
+	if tErr != nil {
+		log.Error().Str("err", tErr.DebugReport()).Msg("invalid template catalog")
+		return tErr
+	}
+	rules, rErr := s.Configuration.GetSignupRules()
+	if rErr != nil {
+		log.Error().Str("err", rErr.DebugReport()).Msg("invalid signup rules")
+		return rErr
+	}
 
-//LaunchGRPC creates the gRPC server, register the necessary handlers and serves it
-func (s *Service) LaunchGRPC() error {
 	clients, cErr := s.GetClients()
 	if cErr != nil {
-		log.Fatal().Str("err", cErr.DebugReport()).Msg("cannot generate clients")
+		log.Error().Str("err", cErr.DebugReport()).Msg("cannot generate clients")
 		return cErr
 	}
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Configuration.Port))
-	if err != nil {
-		log.Fatal().Errs("failed to listen: %v", []error{err})
+	s.clients = clients
+	timeouts := signup.Timeouts{
+		SystemModel:         s.Configuration.SystemModelTimeout,
+		UserManager:         s.Configuration.UserManagerTimeout,
+		OrganizationManager: s.Configuration.OrganizationManagerTimeout,
 	}
+	var resources *signup.ResourceCache
+	if s.Configuration.ResourceCacheTTL > 0 {
+		resources = signup.NewResourceCache(s.Configuration.ResourceCacheTTL, s.Configuration.ResourceCacheSize)
+	}
+	manager := signup.NewManager(clients.orgClient, clients.userClient, clients.clusterClient, clients.nodeClient, clients.appClient,
+		roles, templates, timeouts, s.Configuration.ListConcurrency, resources)
+	idempotency, iErr := signup.NewIdempotencyStore(s.Configuration.IdempotencyTTL, s.Configuration.IdempotencyStorePath)
+	if iErr != nil {
+		log.Error().Str("err", iErr.DebugReport()).Msg("cannot create idempotency store")
+		return iErr
+	}
+	jobs := signup.NewJobManager(&manager, s.Configuration.SignupWorkers, s.Configuration.SignupQueueSize, s.Configuration.SignupJobTTL)
+	jobs.Start()
+	s.handler = signup.NewHandler(manager, s.Configuration.UsePresharedSecret, s.Configuration.PresharedSecret, idempotency, jobs, rules)
 
-	manager := signup.NewManager(clients.orgClient, clients.userClient, clients.clusterClient, clients.appClient)
-	handler := signup.NewHandler(manager, s.Configuration.UsePresharedSecret, s.Configuration.PresharedSecret)
-
-	var grpcServer *grpc.Server
+	var watchCtx context.Context
+	watchCtx, s.stopWatching = context.WithCancel(context.Background())
 	if s.Configuration.UseTLS {
-		creds, err := s.Configuration.GetTLSConfig()
+		reloader, err := NewCredentialReloader(s.Configuration)
 		if err != nil {
-			log.Fatal().Str("err", err.DebugReport()).Msg("error getting TLS configuration")
+			log.Error().Str("err", err.DebugReport()).Msg("cannot load credentials")
+			s.stopWatching()
+			return err
+		}
+		s.credentials = reloader
+		if s.Configuration.CredentialReloadInterval > 0 {
+			go s.credentials.Watch(watchCtx, s.Configuration.CredentialReloadInterval)
+		}
+	}
+	s.healthServer = health.NewServer()
+	s.dependencies = NewDependencyMonitor(s.healthServer)
+	for name, conn := range clients.connections {
+		s.dependencies.Watch(watchCtx, name, conn)
+	}
+
+	s.serveErrors = make(chan error, 4)
+	if err := s.LaunchGRPC(); err != nil {
+		s.Shutdown()
+		return err
+	}
+	if err := s.LaunchHTTP(); err != nil {
+		s.Shutdown()
+		return err
+	}
+	if s.Configuration.MetricsPort > 0 {
+		if err := s.LaunchMetrics(); err != nil {
+			s.Shutdown()
+			return err
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	select {
+	case sig := <-signals:
+		log.Info().Str("signal", sig.String()).Msg("shutdown requested")
+		s.Shutdown()
+		return nil
+	case err := <-s.serveErrors:
+		log.Error().Err(err).Msg("server stopped unexpectedly")
+		s.Shutdown()
+		return err
+	}
+}
+
+//LaunchMetrics creates the metrics server and serves it in background
+func (s *Service) LaunchMetrics() derrors.Error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Configuration.MetricsPort))
+	if err != nil {
+		return derrors.AsError(err, "failed to listen on metrics port")
+	}
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle(s.Configuration.MetricsPath, metrics.Handler())
+	s.metricsServer = &http.Server{
+		Handler: metricsMux,
+	}
+	log.Info().Int("port", s.Configuration.MetricsPort).Str("path", s.Configuration.MetricsPath).Msg("Launching metrics server")
+	go func() {
+		if err := s.metricsServer.Serve(lis); err != http.ErrServerClosed {
+			s.serveErrors <- derrors.AsError(err, "failed to serve metrics")
 		}
+	}()
+	return nil
+}
+
+//LaunchGRPC creates the gRPC server, register the necessary handlers and serves it in background
+func (s *Service) LaunchGRPC() derrors.Error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Configuration.Port))
+	if err != nil {
+		return derrors.AsError(err, "failed to listen on gRPC port")
+	}
+
+	unary := unaryInterceptors()
+	stream := streamInterceptors()
+	options := make([]grpc.ServerOption, 0)
+	if s.Configuration.UseTLS {
 		authData := AuthData{
-			ClientSecret: s.Configuration.ClientSecret,
+			SecretSource: s.credentials.ClientSecret,
 		}
 		log.Debug().Msg("Creating server with TLS config")
-		grpcServer = grpc.NewServer(
-			grpc.Creds(creds),
-			grpc.StreamInterceptor(grpc_auth.StreamServerInterceptor(authData.Authenticate)),
-			grpc.UnaryInterceptor(grpc_auth.UnaryServerInterceptor(authData.Authenticate)),
-		)
+		options = append(options, grpc.Creds(s.credentials.GRPCCredentials()))
+		unary = append(unary, grpc_auth.UnaryServerInterceptor(authData.Authenticate))
+		stream = append(stream, grpc_auth.StreamServerInterceptor(authData.Authenticate))
 	} else {
 		log.Debug().Msg("Creating server without certs")
-		grpcServer = grpc.NewServer()
 	}
-	grpc_signup_go.RegisterSignupServer(grpcServer, handler)
+	options = append(options,
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unary...)),
+		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(stream...)),
+	)
+	s.grpcServer = grpc.NewServer(options...)
+	grpc_signup_go.RegisterSignupServer(s.grpcServer, s.handler)
+	grpc_health_v1.RegisterHealthServer(s.grpcServer, healthService{s.healthServer})
 
 	// Register reflection service on gRPC server.
-	reflection.Register(grpcServer)
+	reflection.Register(s.grpcServer)
 	log.Info().Int("port", s.Configuration.Port).Msg("Launching gRPC server")
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatal().Errs("failed to serve: %v", []error{err})
-	}
+	go func() {
+		if err := s.grpcServer.Serve(lis); err != nil {
+			s.serveErrors <- derrors.AsError(err, "failed to serve gRPC")
+		}
+	}()
 	return nil
 }
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nalej/signup/internal/app/signup/server/signup"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+)
+
+// Shutdown stops the service. New requests are rejected while the in-flight ones, including signups, are given
+// until Config.ShutdownTimeout to finish. Signup jobs that have not been started are cancelled. Once the deadline
+// expires the servers are stopped. Finally, the connections with the other components are closed, waiting up to
+// signup.DefaultRollbackTimeout more if some signups are still being executed or rolled back.
+func (s *Service) Shutdown() {
+	log.Info().Dur("timeout", s.Configuration.ShutdownTimeout).Msg("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), s.Configuration.ShutdownTimeout)
+	defer cancel()
+
+	if s.healthServer != nil {
+		s.healthServer.Shutdown()
+	}
+	// The servers are stopped together so a long request on one of them does not use the time of the others.
+	httpStopped := stopHTTP(ctx, "HTTP gateway", s.httpServer)
+	metricsStopped := stopHTTP(ctx, "metrics", s.metricsServer)
+	grpcStopped := stopGRPC(s.grpcServer)
+	gatewayStopped := stopGRPC(s.gatewayServer)
+	drained := true
+	if s.handler != nil {
+		if !s.handler.Jobs.Stop(ctx) {
+			log.Warn().Msg("running signup jobs have not finished before the shutdown deadline")
+		}
+		drained = s.handler.Manager.Drain(ctx)
+	}
+	waitGRPC(ctx, "gRPC", s.grpcServer, grpcStopped)
+	waitGRPC(ctx, "gateway gRPC", s.gatewayServer, gatewayStopped)
+	<-httpStopped
+	<-metricsStopped
+
+	// The signups cancelled by the stop of the servers are rolled back, so the connections are kept until they finish.
+	if !drained {
+		log.Warn().Msg("in-flight signups have not finished before the shutdown deadline, waiting for their rollback")
+		rollbackCtx, cancelRollback := context.WithTimeout(context.Background(), signup.DefaultRollbackTimeout)
+		if !s.handler.Manager.Drain(rollbackCtx) {
+			log.Error().Msg("in-flight signups have not finished before the rollback deadline")
+		}
+		cancelRollback()
+	}
+
+	if s.stopWatching != nil {
+		s.stopWatching()
+	}
+	if s.clients != nil {
+		for name, conn := range s.clients.connections {
+			if err := conn.Close(); err != nil {
+				log.Warn().Str("dependency", name).Err(err).Msg("cannot close connection")
+			}
+		}
+	}
+	log.Info().Msg("shutdown completed")
+}
+
+// stopHTTP starts the shutdown of an HTTP server, waiting for the in-flight requests until the context is done. The
+// returned channel is closed once the server has stopped.
+func stopHTTP(ctx context.Context, name string, server *http.Server) <-chan struct{} {
+	stopped := make(chan struct{})
+	if server == nil {
+		close(stopped)
+		return stopped
+	}
+	go func() {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Warn().Str("server", name).Err(err).Msg("forcing server stop")
+			_ = server.Close()
+		}
+		close(stopped)
+	}()
+	return stopped
+}
+
+// stopGRPC starts the graceful stop of a gRPC server. The returned channel is closed once the server has stopped.
+func stopGRPC(server *grpc.Server) <-chan struct{} {
+	stopped := make(chan struct{})
+	if server == nil {
+		close(stopped)
+		return stopped
+	}
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	return stopped
+}
+
+// waitGRPC waits for a gRPC server to stop gracefully, stopping it if the context is done first.
+func waitGRPC(ctx context.Context, name string, server *grpc.Server, stopped <-chan struct{}) {
+	if server == nil {
+		return
+	}
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Warn().Str("server", name).Msg("forcing server stop")
+		server.Stop()
+		<-stopped
+	}
+}
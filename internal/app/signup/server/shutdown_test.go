@@ -0,0 +1,90 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-organization-manager-go"
+	"github.com/nalej/grpc-signup-go"
+	"github.com/nalej/signup/internal/app/signup/server/signup"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+)
+
+// blockingOrgClient blocks the creation of organizations until it is released, and then fails it.
+type blockingOrgClient struct {
+	grpc_organization_manager_go.OrganizationsClient
+	started chan struct{}
+	release chan struct{}
+}
+
+func (boc *blockingOrgClient) AddOrganization(ctx context.Context, in *grpc_organization_go.AddOrganizationRequest, opts ...grpc.CallOption) (*grpc_organization_manager_go.Organization, error) {
+	boc.started <- struct{}{}
+	<-boc.release
+	return nil, status.Error(codes.Unavailable, "organization manager is not available")
+}
+
+var _ = ginkgo.Describe("Service shutdown", func() {
+
+	var orgClient *blockingOrgClient
+	var conn *grpc.ClientConn
+	var service *Service
+
+	ginkgo.BeforeEach(func() {
+		orgClient = &blockingOrgClient{started: make(chan struct{}, 1), release: make(chan struct{})}
+		manager := signup.NewManager(orgClient, nil, nil, nil, nil, &signup.DefaultRoleCatalog, &signup.DefaultTemplateCatalog,
+			signup.Timeouts{}, 1, nil)
+		var err error
+		conn, err = grpc.Dial("localhost:0", grpc.WithInsecure())
+		gomega.Expect(err).To(gomega.Succeed())
+		service = &Service{
+			Configuration: Config{ShutdownTimeout: 20 * time.Millisecond},
+			clients:       &Clients{connections: map[string]*grpc.ClientConn{"organization-manager": conn}},
+			handler:       &signup.Handler{Manager: manager, Jobs: signup.NewJobManager(&manager, 1, 1, time.Hour)},
+		}
+	})
+
+	ginkgo.It("should close the connections once the service is stopped", func() {
+		service.Shutdown()
+		gomega.Expect(conn.GetState()).To(gomega.Equal(connectivity.Shutdown))
+	})
+
+	ginkgo.It("should keep the connections until the signups are rolled back after the deadline", func() {
+		go func() {
+			_, _ = service.handler.Manager.SignupOrganization(context.Background(),
+				&grpc_signup_go.SignupOrganizationRequest{OrganizationName: "acme"})
+		}()
+		<-orgClient.started
+		stopped := make(chan struct{})
+		go func() {
+			service.Shutdown()
+			close(stopped)
+		}()
+		gomega.Consistently(stopped, 200*time.Millisecond).ShouldNot(gomega.BeClosed())
+		gomega.Expect(conn.GetState()).NotTo(gomega.Equal(connectivity.Shutdown))
+		close(orgClient.release)
+		gomega.Eventually(stopped, time.Second).Should(gomega.BeClosed())
+		gomega.Expect(conn.GetState()).To(gomega.Equal(connectivity.Shutdown))
+	})
+})
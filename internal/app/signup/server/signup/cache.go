@@ -0,0 +1,145 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/nalej/signup/internal/app/signup/server/metrics"
+)
+
+// organizationResources contains the number of clusters, application descriptors and application instances of an
+// organization.
+type organizationResources struct {
+	clusters    int32
+	descriptors int32
+	instances   int32
+}
+
+// resourceEntry is an element of the cache.
+type resourceEntry struct {
+	organizationID string
+	resources      organizationResources
+	expires        time.Time
+}
+
+// ResourceCache keeps the resources of the organizations retrieved from System Model for a given time. When the
+// cache is full, the least recently used organization is evicted. A nil cache never contains any organization.
+type ResourceCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	// order contains the entries from the most to the least recently used.
+	order   *list.List
+	entries map[string]*list.Element
+	// generations counts the invalidations of each organization, so resources retrieved before an invalidation are
+	// not stored after it.
+	generations map[string]uint64
+}
+
+// NewResourceCache creates a cache whose entries expire after the given time, with at most maxSize organizations.
+func NewResourceCache(ttl time.Duration, maxSize int) *ResourceCache {
+	return &ResourceCache{
+		ttl:         ttl,
+		maxSize:     maxSize,
+		order:       list.New(),
+		entries:     make(map[string]*list.Element, maxSize),
+		generations: make(map[string]uint64, 0),
+	}
+}
+
+// get returns the resources of an organization if they are cached and have not expired.
+func (rc *ResourceCache) get(organizationID string) (organizationResources, bool) {
+	if rc == nil {
+		return organizationResources{}, false
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	element, exists := rc.entries[organizationID]
+	if !exists {
+		metrics.ObserveCacheLookup(false)
+		return organizationResources{}, false
+	}
+	entry := element.Value.(*resourceEntry)
+	if time.Now().After(entry.expires) {
+		rc.order.Remove(element)
+		delete(rc.entries, organizationID)
+		metrics.ObserveCacheLookup(false)
+		return organizationResources{}, false
+	}
+	rc.order.MoveToFront(element)
+	metrics.ObserveCacheLookup(true)
+	return entry.resources, true
+}
+
+// generation returns the number of times an organization has been invalidated. It must be read before retrieving
+// the resources to be stored.
+func (rc *ResourceCache) generation(organizationID string) uint64 {
+	if rc == nil {
+		return 0
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	return rc.generations[organizationID]
+}
+
+// put stores the resources of an organization retrieved at the given generation, evicting the least recently used
+// one if the cache is full. The resources are discarded if the organization has been invalidated since then.
+func (rc *ResourceCache) put(organizationID string, generation uint64, resources organizationResources) {
+	if rc == nil {
+		return
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	if rc.generations[organizationID] != generation {
+		return
+	}
+	expires := time.Now().Add(rc.ttl)
+	if element, exists := rc.entries[organizationID]; exists {
+		entry := element.Value.(*resourceEntry)
+		entry.resources = resources
+		entry.expires = expires
+		rc.order.MoveToFront(element)
+		return
+	}
+	if rc.order.Len() >= rc.maxSize {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*resourceEntry).organizationID)
+	}
+	rc.entries[organizationID] = rc.order.PushFront(&resourceEntry{
+		organizationID: organizationID,
+		resources:      resources,
+		expires:        expires,
+	})
+}
+
+// Invalidate removes the resources of an organization from the cache, and discards the ones being retrieved.
+func (rc *ResourceCache) Invalidate(organizationID string) {
+	if rc == nil {
+		return
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	rc.generations[organizationID]++
+	if element, exists := rc.entries[organizationID]; exists {
+		rc.order.Remove(element)
+		delete(rc.entries, organizationID)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Resource cache", func() {
+
+	var cache *ResourceCache
+
+	// cached checks if the resources of an organization are in the cache.
+	cached := func(organizationID string) bool {
+		_, found := cache.get(organizationID)
+		return found
+	}
+
+	ginkgo.BeforeEach(func() {
+		cache = NewResourceCache(time.Minute, 2)
+	})
+
+	ginkgo.It("should return the stored resources", func() {
+		cache.put("org-1", 0, organizationResources{clusters: 1, descriptors: 2, instances: 3})
+		resources, found := cache.get("org-1")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(resources).To(gomega.Equal(organizationResources{clusters: 1, descriptors: 2, instances: 3}))
+		gomega.Expect(cached("org-2")).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should replace the resources of an organization", func() {
+		cache.put("org-1", 0, organizationResources{clusters: 1})
+		cache.put("org-1", 0, organizationResources{clusters: 2})
+		resources, _ := cache.get("org-1")
+		gomega.Expect(resources.clusters).To(gomega.Equal(int32(2)))
+		gomega.Expect(cache.order.Len()).To(gomega.Equal(1))
+	})
+
+	ginkgo.It("should evict the least recently used organization", func() {
+		cache.put("org-1", 0, organizationResources{})
+		cache.put("org-2", 0, organizationResources{})
+		gomega.Expect(cached("org-1")).To(gomega.BeTrue())
+		cache.put("org-3", 0, organizationResources{})
+		gomega.Expect(cached("org-2")).To(gomega.BeFalse())
+		gomega.Expect(cached("org-1")).To(gomega.BeTrue())
+		gomega.Expect(cached("org-3")).To(gomega.BeTrue())
+		gomega.Expect(cache.entries).To(gomega.HaveLen(2))
+	})
+
+	ginkgo.It("should expire the resources after the TTL", func() {
+		cache = NewResourceCache(20*time.Millisecond, 2)
+		cache.put("org-1", 0, organizationResources{})
+		gomega.Expect(cached("org-1")).To(gomega.BeTrue())
+		gomega.Eventually(func() bool {
+			return cached("org-1")
+		}).Should(gomega.BeFalse())
+		gomega.Expect(cache.entries).To(gomega.BeEmpty())
+		gomega.Expect(cache.order.Len()).To(gomega.BeZero())
+	})
+
+	ginkgo.It("should invalidate the resources of an organization", func() {
+		cache.put("org-1", 0, organizationResources{})
+		cache.put("org-2", 0, organizationResources{})
+		cache.Invalidate("org-1")
+		cache.Invalidate("org-3")
+		gomega.Expect(cached("org-1")).To(gomega.BeFalse())
+		gomega.Expect(cached("org-2")).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should discard the resources retrieved before an invalidation", func() {
+		generation := cache.generation("org-1")
+		cache.Invalidate("org-1")
+		cache.put("org-1", generation, organizationResources{clusters: 1})
+		gomega.Expect(cached("org-1")).To(gomega.BeFalse())
+
+		cache.put("org-1", cache.generation("org-1"), organizationResources{clusters: 2})
+		resources, found := cache.get("org-1")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(resources.clusters).To(gomega.Equal(int32(2)))
+	})
+
+	ginkgo.It("should never contain organizations if it is disabled", func() {
+		cache = nil
+		cache.put("org-1", 0, organizationResources{})
+		cache.Invalidate("org-1")
+		gomega.Expect(cached("org-1")).To(gomega.BeFalse())
+	})
+})
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// DefaultRollbackTimeout is the maximum time to revert a failed signup.
+const DefaultRollbackTimeout = time.Minute
+
+// propagatedMetadata contains the metadata keys of the incoming requests that are forwarded to other components.
+var propagatedMetadata = []string{"x-request-id", "traceparent", "tracestate"}
+
+// Timeouts contains the maximum duration of the requests sent to each component. A zero value means the requests
+// are only bounded by the incoming request context.
+type Timeouts struct {
+	SystemModel         time.Duration
+	UserManager         time.Duration
+	OrganizationManager time.Duration
+}
+
+// outgoingContext forwards the propagated metadata of an incoming request.
+func outgoingContext(ctx context.Context) context.Context {
+	incoming, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	outgoing, found := metadata.FromOutgoingContext(ctx)
+	if found {
+		outgoing = outgoing.Copy()
+	} else {
+		outgoing = metadata.MD{}
+	}
+	for _, key := range propagatedMetadata {
+		if values := incoming.Get(key); len(values) > 0 {
+			outgoing.Set(key, values...)
+		}
+	}
+	return metadata.NewOutgoingContext(ctx, outgoing)
+}
+
+// requestContext creates the context of a request sent to another component.
+func requestContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx = outgoingContext(ctx)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// systemModelContext creates the context of a request sent to the system model.
+func (m *Manager) systemModelContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return requestContext(ctx, m.timeouts.SystemModel)
+}
+
+// userManagerContext creates the context of a request sent to the user manager.
+func (m *Manager) userManagerContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return requestContext(ctx, m.timeouts.UserManager)
+}
+
+// organizationManagerContext creates the context of a request sent to the organization manager.
+func (m *Manager) organizationManagerContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return requestContext(ctx, m.timeouts.OrganizationManager)
+}
+
+// detachedMetadata creates a context that keeps the metadata of the request but is not cancelled with it.
+func detachedMetadata(ctx context.Context) context.Context {
+	detached := context.Background()
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		detached = metadata.NewIncomingContext(detached, md)
+	}
+	return detached
+}
+
+// detachedContext creates a context that keeps the propagated metadata of the request but is not cancelled with
+// it. It is used to revert failed signups even if the client has gone away.
+func detachedContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedMetadata(ctx), timeout)
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-signup-go"
+	"github.com/nalej/grpc-user-manager-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+)
+
+// GetOrganizationDetailedInfo retrieves the information about an organization together with its clusters,
+// application descriptors and application instances, and the number of users of each role. The resources are always
+// retrieved from the other components, and the ones that cannot be retrieved are reported in the error of the
+// organization information.
+func (m *Manager) GetOrganizationDetailedInfo(ctx context.Context, organizationID *grpc_organization_go.OrganizationId) (*grpc_signup_go.OrganizationDetailedInfo, error) {
+	orgCtx, cancel := m.organizationManagerContext(ctx)
+	defer cancel()
+	org, err := m.OrgClient.GetOrganization(orgCtx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	info := organizationInfo(org)
+
+	var lists *resourceLists
+	var users *grpc_user_manager_go.UserList
+	var roles *grpc_user_manager_go.RoleList
+	var userErr, roleErr error
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		lists = m.listResources(ctx, org.OrganizationId)
+	}()
+	go func() {
+		defer wg.Done()
+		userCtx, cancel := m.userManagerContext(ctx)
+		defer cancel()
+		users, userErr = m.UserClient.ListUsers(userCtx, organizationID)
+	}()
+	go func() {
+		defer wg.Done()
+		roleCtx, cancel := m.userManagerContext(ctx)
+		defer cancel()
+		roles, roleErr = m.UserClient.ListRoles(roleCtx, organizationID)
+	}()
+	wg.Wait()
+
+	m.applyResources(info, lists)
+	detailed := &grpc_signup_go.OrganizationDetailedInfo{
+		Info:        info,
+		Clusters:    make([]*grpc_signup_go.ClusterSummary, 0),
+		Descriptors: make([]*grpc_signup_go.DescriptorSummary, 0),
+		Instances:   make([]*grpc_signup_go.InstanceSummary, 0),
+		UsersByRole: make(map[string]int32, 0),
+	}
+	if lists.clusterErr == nil {
+		for _, cluster := range lists.clusters.Clusters {
+			detailed.Clusters = append(detailed.Clusters, &grpc_signup_go.ClusterSummary{
+				ClusterId: cluster.ClusterId,
+				Name:      cluster.Name,
+				State:     cluster.State.String(),
+			})
+		}
+	}
+	if lists.descriptorErr == nil {
+		for _, descriptor := range lists.descriptors.Descriptors {
+			detailed.Descriptors = append(detailed.Descriptors, &grpc_signup_go.DescriptorSummary{
+				AppDescriptorId: descriptor.AppDescriptorId,
+				Name:            descriptor.Name,
+			})
+		}
+	}
+	if lists.instanceErr == nil {
+		for _, instance := range lists.instances.Instances {
+			detailed.Instances = append(detailed.Instances, &grpc_signup_go.InstanceSummary{
+				AppInstanceId:   instance.AppInstanceId,
+				AppDescriptorId: instance.AppDescriptorId,
+				Name:            instance.Name,
+				Status:          instance.Status.String(),
+			})
+		}
+	}
+
+	// Roles without users are reported with zero users, and no role is reported if the users are not available.
+	failures := make([]string, 0)
+	if roleErr == nil {
+		if userErr == nil {
+			for _, role := range roles.Roles {
+				detailed.UsersByRole[role.Name] = 0
+			}
+		}
+	} else {
+		log.Warn().Str("organizationID", org.OrganizationId).Str("trace", conversions.ToDerror(roleErr).DebugReport()).Msg("cannot retrieve roles")
+		failures = append(failures, fmt.Sprintf("cannot retrieve roles: %s", conversions.ToDerror(roleErr).Error()))
+	}
+	if userErr == nil {
+		for _, user := range users.Users {
+			detailed.UsersByRole[user.RoleName]++
+		}
+	} else {
+		log.Warn().Str("organizationID", org.OrganizationId).Str("trace", conversions.ToDerror(userErr).DebugReport()).Msg("cannot retrieve users")
+		failures = append(failures, fmt.Sprintf("cannot retrieve users: %s", conversions.ToDerror(userErr).Error()))
+	}
+	if len(failures) > 0 {
+		if info.Error != "" {
+			failures = append([]string{info.Error}, failures...)
+		}
+		info.Error = strings.Join(failures, "; ")
+	}
+	return detailed, nil
+}
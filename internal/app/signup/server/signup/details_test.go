@@ -0,0 +1,118 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+
+	"github.com/nalej/grpc-application-go"
+	"github.com/nalej/grpc-infrastructure-go"
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-organization-manager-go"
+	"github.com/nalej/grpc-signup-go"
+	"github.com/nalej/grpc-user-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = ginkgo.Describe("Organization detailed info", func() {
+
+	var system *fakeSystem
+	var manager Manager
+	organizationID := &grpc_organization_go.OrganizationId{OrganizationId: fakeOrganizationID}
+
+	ginkgo.BeforeEach(func() {
+		system = newFakeSystem()
+		system.organizations = []*grpc_organization_manager_go.Organization{{OrganizationId: fakeOrganizationID, Name: "acme", NumUsers: 3}}
+		system.clusters = []*grpc_infrastructure_go.Cluster{{ClusterId: "c1", Name: "edge"}}
+		system.descriptors = []*grpc_application_go.AppDescriptor{{AppDescriptorId: "d1", Name: "wordpress"}}
+		system.instances = []*grpc_application_go.AppInstance{
+			{AppInstanceId: "i1", AppDescriptorId: "d1", Name: "blog"},
+			{AppInstanceId: "i2", AppDescriptorId: "d1", Name: "shop"},
+		}
+		system.users = []*grpc_user_manager_go.User{
+			{Email: "owner@acme.com", RoleName: OwnerRoleName},
+			{Email: "admin@nalej.com", RoleName: NalejAdminRoleName},
+			{Email: "dev@acme.com", RoleName: OwnerRoleName},
+		}
+		system.roles = []*grpc_user_manager_go.Role{{Name: OwnerRoleName}, {Name: NalejAdminRoleName}, {Name: "Operator"}}
+		manager = system.manager(&DefaultRoleCatalog, &DefaultTemplateCatalog)
+	})
+
+	ginkgo.It("should summarize the resources and users of the organization", func() {
+		detailed, err := manager.GetOrganizationDetailedInfo(context.Background(), organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(detailed.Info.Name).To(gomega.Equal("acme"))
+		gomega.Expect(detailed.Info.Error).To(gomega.BeEmpty())
+		gomega.Expect(detailed.Info.NumberClusters).To(gomega.Equal(int32(1)))
+		gomega.Expect(detailed.Info.NumberDescriptors).To(gomega.Equal(int32(1)))
+		gomega.Expect(detailed.Info.NumberInstances).To(gomega.Equal(int32(2)))
+		gomega.Expect(detailed.Clusters).To(gomega.Equal([]*grpc_signup_go.ClusterSummary{
+			{ClusterId: "c1", Name: "edge", State: system.clusters[0].State.String()},
+		}))
+		gomega.Expect(detailed.Descriptors).To(gomega.Equal([]*grpc_signup_go.DescriptorSummary{
+			{AppDescriptorId: "d1", Name: "wordpress"},
+		}))
+		gomega.Expect(detailed.Instances).To(gomega.Equal([]*grpc_signup_go.InstanceSummary{
+			{AppInstanceId: "i1", AppDescriptorId: "d1", Name: "blog", Status: system.instances[0].Status.String()},
+			{AppInstanceId: "i2", AppDescriptorId: "d1", Name: "shop", Status: system.instances[1].Status.String()},
+		}))
+		gomega.Expect(detailed.UsersByRole).To(gomega.Equal(map[string]int32{
+			OwnerRoleName: 2, NalejAdminRoleName: 1, "Operator": 0,
+		}))
+	})
+
+	ginkgo.It("should return the error if the organization cannot be retrieved", func() {
+		system.fail("get organization org-1", codes.NotFound)
+		_, err := manager.GetOrganizationDetailedInfo(context.Background(), organizationID)
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.NotFound))
+	})
+
+	ginkgo.It("should report the resources that cannot be retrieved", func() {
+		system.fail("list instances", codes.Unavailable)
+		detailed, err := manager.GetOrganizationDetailedInfo(context.Background(), organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(detailed.Info.Error).To(gomega.ContainSubstring("cannot retrieve application instances"))
+		gomega.Expect(detailed.Info.NumberInstances).To(gomega.Equal(int32(UnavailableCount)))
+		gomega.Expect(detailed.Instances).To(gomega.BeEmpty())
+		gomega.Expect(detailed.Clusters).To(gomega.HaveLen(1))
+		gomega.Expect(detailed.Descriptors).To(gomega.HaveLen(1))
+		gomega.Expect(detailed.UsersByRole).To(gomega.HaveLen(3))
+	})
+
+	ginkgo.It("should not report any role if the users cannot be retrieved", func() {
+		system.fail("list users", codes.Unavailable)
+		detailed, err := manager.GetOrganizationDetailedInfo(context.Background(), organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(detailed.Info.Error).To(gomega.ContainSubstring("cannot retrieve users"))
+		gomega.Expect(detailed.UsersByRole).To(gomega.BeEmpty())
+		gomega.Expect(detailed.Instances).To(gomega.HaveLen(2))
+	})
+
+	ginkgo.It("should only report the roles with users if the roles cannot be retrieved", func() {
+		system.fail("list roles", codes.Unavailable)
+		system.fail("list clusters", codes.Internal)
+		detailed, err := manager.GetOrganizationDetailedInfo(context.Background(), organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(detailed.Info.Error).To(gomega.ContainSubstring("cannot retrieve roles"))
+		gomega.Expect(detailed.Info.Error).To(gomega.ContainSubstring("cannot retrieve clusters"))
+		gomega.Expect(detailed.Clusters).To(gomega.BeEmpty())
+		gomega.Expect(detailed.UsersByRole).To(gomega.Equal(map[string]int32{OwnerRoleName: 2, NalejAdminRoleName: 1}))
+	})
+})
@@ -0,0 +1,252 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nalej/grpc-application-go"
+	"github.com/nalej/grpc-authx-go"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-infrastructure-go"
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-organization-manager-go"
+	"github.com/nalej/grpc-user-go"
+	"github.com/nalej/grpc-user-manager-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeOrganizationID is the identifier of the organizations created through the fake clients.
+const fakeOrganizationID = "org-1"
+
+// fakeSystem contains the elements returned by the fake clients of the other components. Every call is recorded in
+// order, and the calls registered with fail return an error.
+type fakeSystem struct {
+	sync.Mutex
+	calls         []string
+	failures      map[string]error
+	organizations []*grpc_organization_manager_go.Organization
+	clusters      []*grpc_infrastructure_go.Cluster
+	nodes         []*grpc_infrastructure_go.Node
+	descriptors   []*grpc_application_go.AppDescriptor
+	instances     []*grpc_application_go.AppInstance
+	users         []*grpc_user_manager_go.User
+	roles         []*grpc_user_manager_go.Role
+}
+
+// newFakeSystem creates a system without any element.
+func newFakeSystem() *fakeSystem {
+	return &fakeSystem{
+		calls:    make([]string, 0),
+		failures: make(map[string]error, 0),
+	}
+}
+
+// manager creates a manager that uses the fake clients with the given catalogs.
+func (fs *fakeSystem) manager(roles *RoleCatalog, templates *TemplateCatalog) Manager {
+	return NewManager(&fakeOrgClient{fakeSystem: fs}, &fakeUserClient{fakeSystem: fs}, &fakeClusterClient{fakeSystem: fs},
+		&fakeNodeClient{fakeSystem: fs}, &fakeAppClient{fakeSystem: fs}, roles, templates, Timeouts{}, 2, nil)
+}
+
+// fail makes a call fail with the given code.
+func (fs *fakeSystem) fail(call string, code codes.Code) {
+	fs.failures[call] = status.Errorf(code, "%s failed", call)
+}
+
+// call records a call and returns its failure, if any.
+func (fs *fakeSystem) call(format string, args ...interface{}) error {
+	fs.Lock()
+	defer fs.Unlock()
+	call := fmt.Sprintf(format, args...)
+	fs.calls = append(fs.calls, call)
+	return fs.failures[call]
+}
+
+// recorded returns the calls that start with the given prefix, such as add or remove, in order.
+func (fs *fakeSystem) recorded(prefix string) []string {
+	fs.Lock()
+	defer fs.Unlock()
+	calls := make([]string, 0)
+	for _, call := range fs.calls {
+		if strings.HasPrefix(call, prefix) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// fakeRoleID returns the identifier given to a role created through the fake clients.
+func fakeRoleID(name string) string {
+	return fmt.Sprintf("role-%s", strings.ToLower(name))
+}
+
+type fakeOrgClient struct {
+	grpc_organization_manager_go.OrganizationsClient
+	*fakeSystem
+}
+
+func (foc *fakeOrgClient) AddOrganization(ctx context.Context, in *grpc_organization_go.AddOrganizationRequest, opts ...grpc.CallOption) (*grpc_organization_manager_go.Organization, error) {
+	if err := foc.call("add organization %s", in.Name); err != nil {
+		return nil, err
+	}
+	return &grpc_organization_manager_go.Organization{OrganizationId: fakeOrganizationID, Name: in.Name, Email: in.Email}, nil
+}
+
+func (foc *fakeOrgClient) GetOrganization(ctx context.Context, in *grpc_organization_go.OrganizationId, opts ...grpc.CallOption) (*grpc_organization_manager_go.Organization, error) {
+	if err := foc.call("get organization %s", in.OrganizationId); err != nil {
+		return nil, err
+	}
+	for _, org := range foc.organizations {
+		if org.OrganizationId == in.OrganizationId {
+			return org, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "organization not found")
+}
+
+func (foc *fakeOrgClient) ListOrganizations(ctx context.Context, in *grpc_common_go.Empty, opts ...grpc.CallOption) (*grpc_organization_manager_go.OrganizationList, error) {
+	if err := foc.call("list organizations"); err != nil {
+		return nil, err
+	}
+	return &grpc_organization_manager_go.OrganizationList{Organizations: foc.organizations}, nil
+}
+
+func (foc *fakeOrgClient) RemoveOrganization(ctx context.Context, in *grpc_organization_go.OrganizationId, opts ...grpc.CallOption) (*grpc_common_go.Success, error) {
+	return &grpc_common_go.Success{}, foc.call("remove organization %s", in.OrganizationId)
+}
+
+func (foc *fakeOrgClient) AddSetting(ctx context.Context, in *grpc_organization_go.AddSettingRequest, opts ...grpc.CallOption) (*grpc_organization_manager_go.Setting, error) {
+	if err := foc.call("add setting %s", in.Key); err != nil {
+		return nil, err
+	}
+	return &grpc_organization_manager_go.Setting{OrganizationId: in.OrganizationId, Key: in.Key, Value: in.Value}, nil
+}
+
+func (foc *fakeOrgClient) RemoveSetting(ctx context.Context, in *grpc_organization_go.SettingKey, opts ...grpc.CallOption) (*grpc_common_go.Success, error) {
+	return &grpc_common_go.Success{}, foc.call("remove setting %s", in.Key)
+}
+
+type fakeUserClient struct {
+	grpc_user_manager_go.UserManagerClient
+	*fakeSystem
+}
+
+func (fuc *fakeUserClient) AddUser(ctx context.Context, in *grpc_user_manager_go.AddUserRequest, opts ...grpc.CallOption) (*grpc_user_manager_go.User, error) {
+	if err := fuc.call("add user %s with %s", in.Email, in.RoleId); err != nil {
+		return nil, err
+	}
+	return &grpc_user_manager_go.User{OrganizationId: in.OrganizationId, Email: in.Email, RoleId: in.RoleId}, nil
+}
+
+func (fuc *fakeUserClient) RemoveUser(ctx context.Context, in *grpc_user_go.UserId, opts ...grpc.CallOption) (*grpc_common_go.Success, error) {
+	return &grpc_common_go.Success{}, fuc.call("remove user %s", in.Email)
+}
+
+func (fuc *fakeUserClient) ListUsers(ctx context.Context, in *grpc_organization_go.OrganizationId, opts ...grpc.CallOption) (*grpc_user_manager_go.UserList, error) {
+	if err := fuc.call("list users"); err != nil {
+		return nil, err
+	}
+	return &grpc_user_manager_go.UserList{Users: fuc.users}, nil
+}
+
+func (fuc *fakeUserClient) AddRole(ctx context.Context, in *grpc_user_manager_go.AddRoleRequest, opts ...grpc.CallOption) (*grpc_user_manager_go.Role, error) {
+	if err := fuc.call("add role %s", in.Name); err != nil {
+		return nil, err
+	}
+	return &grpc_user_manager_go.Role{OrganizationId: in.OrganizationId, RoleId: fakeRoleID(in.Name), Name: in.Name}, nil
+}
+
+func (fuc *fakeUserClient) RemoveRole(ctx context.Context, in *grpc_authx_go.RoleId, opts ...grpc.CallOption) (*grpc_common_go.Success, error) {
+	return &grpc_common_go.Success{}, fuc.call("remove role %s", in.RoleId)
+}
+
+func (fuc *fakeUserClient) ListRoles(ctx context.Context, in *grpc_organization_go.OrganizationId, opts ...grpc.CallOption) (*grpc_user_manager_go.RoleList, error) {
+	if err := fuc.call("list roles"); err != nil {
+		return nil, err
+	}
+	return &grpc_user_manager_go.RoleList{Roles: fuc.roles}, nil
+}
+
+type fakeClusterClient struct {
+	grpc_infrastructure_go.ClustersClient
+	*fakeSystem
+}
+
+func (fcc *fakeClusterClient) ListClusters(ctx context.Context, in *grpc_organization_go.OrganizationId, opts ...grpc.CallOption) (*grpc_infrastructure_go.ClusterList, error) {
+	if err := fcc.call("list clusters"); err != nil {
+		return nil, err
+	}
+	return &grpc_infrastructure_go.ClusterList{Clusters: fcc.clusters}, nil
+}
+
+func (fcc *fakeClusterClient) RemoveCluster(ctx context.Context, in *grpc_infrastructure_go.RemoveClusterRequest, opts ...grpc.CallOption) (*grpc_common_go.Success, error) {
+	return &grpc_common_go.Success{}, fcc.call("remove cluster %s", in.ClusterId)
+}
+
+type fakeNodeClient struct {
+	grpc_infrastructure_go.NodesClient
+	*fakeSystem
+}
+
+func (fnc *fakeNodeClient) ListNodes(ctx context.Context, in *grpc_infrastructure_go.ClusterId, opts ...grpc.CallOption) (*grpc_infrastructure_go.NodeList, error) {
+	if err := fnc.call("list nodes %s", in.ClusterId); err != nil {
+		return nil, err
+	}
+	nodes := make([]*grpc_infrastructure_go.Node, 0)
+	for _, node := range fnc.nodes {
+		if node.ClusterId == in.ClusterId {
+			nodes = append(nodes, node)
+		}
+	}
+	return &grpc_infrastructure_go.NodeList{Nodes: nodes}, nil
+}
+
+func (fnc *fakeNodeClient) RemoveNodes(ctx context.Context, in *grpc_infrastructure_go.RemoveNodesRequest, opts ...grpc.CallOption) (*grpc_common_go.Success, error) {
+	return &grpc_common_go.Success{}, fnc.call("remove nodes %s", strings.Join(in.Nodes, ","))
+}
+
+type fakeAppClient struct {
+	grpc_application_go.ApplicationsClient
+	*fakeSystem
+}
+
+func (fac *fakeAppClient) ListAppDescriptors(ctx context.Context, in *grpc_organization_go.OrganizationId, opts ...grpc.CallOption) (*grpc_application_go.AppDescriptorList, error) {
+	if err := fac.call("list descriptors"); err != nil {
+		return nil, err
+	}
+	return &grpc_application_go.AppDescriptorList{Descriptors: fac.descriptors}, nil
+}
+
+func (fac *fakeAppClient) ListAppInstances(ctx context.Context, in *grpc_organization_go.OrganizationId, opts ...grpc.CallOption) (*grpc_application_go.AppInstanceList, error) {
+	if err := fac.call("list instances"); err != nil {
+		return nil, err
+	}
+	return &grpc_application_go.AppInstanceList{Instances: fac.instances}, nil
+}
+
+func (fac *fakeAppClient) RemoveAppDescriptor(ctx context.Context, in *grpc_application_go.AppDescriptorId, opts ...grpc.CallOption) (*grpc_common_go.Success, error) {
+	return &grpc_common_go.Success{}, fac.call("remove descriptor %s", in.AppDescriptorId)
+}
+
+func (fac *fakeAppClient) RemoveAppInstance(ctx context.Context, in *grpc_application_go.AppInstanceId, opts ...grpc.CallOption) (*grpc_common_go.Success, error) {
+	return &grpc_common_go.Success{}, fac.call("remove instance %s", in.AppInstanceId)
+}
@@ -22,28 +22,47 @@ import (
 	"github.com/nalej/grpc-common-go"
 	"github.com/nalej/grpc-organization-go"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/nalej/grpc-signup-go"
 	"github.com/nalej/grpc-utils/pkg/conversions"
 	"github.com/nalej/signup/internal/pkg/entities"
 )
 
-// Handler structure for the cluster requests.
+// Handler structure for the cluster requests. Errors returned as derrors.Error are converted into gRPC status
+// errors by the server interceptors.
 type Handler struct {
 	Manager              Manager
 	CheckPresharedSecret bool
 	PresharedSecret      string
+	// Idempotency stores the result of the signups that contain an idempotency key.
+	Idempotency *IdempotencyStore
+	// Jobs executes the signups in background.
+	Jobs *JobManager
+	// Rules contains the rules applied to the fields of the signup requests.
+	Rules *entities.SignupRules
 }
 
 // NewHandler creates a new Handler with a linked manager.
-func NewHandler(manager Manager, checkPresharedSecret bool, presharedSecret string) *Handler {
-	return &Handler{manager, checkPresharedSecret, presharedSecret}
+func NewHandler(manager Manager, checkPresharedSecret bool, presharedSecret string, idempotency *IdempotencyStore, jobs *JobManager, rules *entities.SignupRules) *Handler {
+	return &Handler{manager, checkPresharedSecret, presharedSecret, idempotency, jobs, rules}
 }
 
-func (h *Handler) checkPresharedSecret(found string) derrors.Error {
+// PresharedSecretMetadataKey is the metadata key that may contain the preshared secret when it is not sent in the
+// request. It is used by the HTTP gateway.
+const PresharedSecretMetadataKey = "preshared-secret"
+
+func (h *Handler) checkPresharedSecret(ctx context.Context, found string) derrors.Error {
 	if !h.CheckPresharedSecret {
 		return nil
 	}
+	if found == "" {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(PresharedSecretMetadataKey); len(values) > 0 {
+				found = values[0]
+			}
+		}
+	}
 	if h.PresharedSecret != found {
 		return derrors.NewPermissionDeniedError("invalid preshared secret")
 	}
@@ -53,37 +72,128 @@ func (h *Handler) checkPresharedSecret(found string) derrors.Error {
 // SignupOrganization register a new organization in the system with a new
 // user as the owner.
 func (h *Handler) SignupOrganization(ctx context.Context, signupRequest *grpc_signup_go.SignupOrganizationRequest) (*grpc_signup_go.SignupOrganizationResponse, error) {
-	sErr := h.checkPresharedSecret(signupRequest.PresharedSecret)
+	sErr := h.checkPresharedSecret(ctx, signupRequest.PresharedSecret)
 	if sErr != nil {
 		log.Error().Str("trace", conversions.ToDerror(sErr).DebugReport()).Msg("error validating secret")
 		return nil, sErr
 	}
-	vErr := entities.ValidSignupOrganizationRequest(signupRequest)
+	vErr := entities.ValidSignupOrganizationRequest(signupRequest, h.Rules)
 	if vErr != nil {
-		return nil, conversions.ToGRPCError(vErr)
+		return nil, vErr
+	}
+	if signupRequest.DryRun {
+		plan, err := h.Manager.PlanSignupOrganization(ctx, signupRequest)
+		if err != nil {
+			return nil, err
+		}
+		return &grpc_signup_go.SignupOrganizationResponse{
+			Plan: plan,
+		}, nil
+	}
+	key := idempotencyKey(ctx)
+	if key == "" || h.Idempotency == nil {
+		result, err := h.Manager.SignupOrganization(ctx, signupRequest)
+		if err != nil {
+			return nil, err
+		}
+		return result.toGRPC(), nil
+	}
+	return h.idempotentSignup(ctx, key, signupRequest)
+}
+
+// idempotentSignup executes a signup only if no other signup with the same key has been completed. Replays of a
+// completed signup return the identifier of the organization that was created and the settings applied to it.
+func (h *Handler) idempotentSignup(ctx context.Context, key string, signupRequest *grpc_signup_go.SignupOrganizationRequest) (*grpc_signup_go.SignupOrganizationResponse, error) {
+	if len(key) > MaxIdempotencyKeyLength {
+		return nil, derrors.NewInvalidArgumentError("idempotency key is too long")
 	}
-	organization, err := h.Manager.SignupOrganization(signupRequest)
+	previous, err := h.Idempotency.Reserve(key, signupFingerprint(signupRequest))
 	if err != nil {
 		return nil, err
 	}
-	return &grpc_signup_go.SignupOrganizationResponse{
-		OrganizationId: organization.OrganizationId,
-	}, nil
+	if previous != nil {
+		log.Info().Str("organizationID", previous.OrganizationId).Msg("replaying signup with the same idempotency key")
+		return previous, nil
+	}
+	// The reservation is released if the signup fails, even with a panic, so it can be retried.
+	completed := false
+	defer func() {
+		if !completed {
+			h.Idempotency.Release(key)
+		}
+	}()
+	result, sErr := h.Manager.SignupOrganization(ctx, signupRequest)
+	if sErr != nil {
+		return nil, sErr
+	}
+	response := result.toGRPC()
+	h.Idempotency.Complete(key, response)
+	completed = true
+	return response, nil
+}
+
+// SubmitSignupJob queues the signup of a new organization and returns the job that tracks its progress.
+func (h *Handler) SubmitSignupJob(ctx context.Context, signupRequest *grpc_signup_go.SignupOrganizationRequest) (*grpc_signup_go.SignupJob, error) {
+	sErr := h.checkPresharedSecret(ctx, signupRequest.PresharedSecret)
+	if sErr != nil {
+		log.Error().Str("trace", conversions.ToDerror(sErr).DebugReport()).Msg("error validating secret")
+		return nil, sErr
+	}
+	vErr := entities.ValidSignupOrganizationRequest(signupRequest, h.Rules)
+	if vErr != nil {
+		return nil, vErr
+	}
+	if signupRequest.DryRun {
+		return nil, derrors.NewInvalidArgumentError("dry run is not supported on signup jobs, use SignupOrganization instead")
+	}
+	return h.Jobs.Submit(ctx, signupRequest)
+}
+
+// GetSignupJob retrieves the current state of a signup job.
+func (h *Handler) GetSignupJob(ctx context.Context, request *grpc_signup_go.SignupJobRequest) (*grpc_signup_go.SignupJob, error) {
+	sErr := h.checkPresharedSecret(ctx, request.PresharedSecret)
+	if sErr != nil {
+		log.Error().Str("trace", conversions.ToDerror(sErr).DebugReport()).Msg("error validating secret")
+		return nil, sErr
+	}
+	vErr := entities.ValidSignupJobRequest(request)
+	if vErr != nil {
+		return nil, vErr
+	}
+	return h.Jobs.Get(request.JobId)
 }
 
-// ListOrganizations returns the list of organizations in the system.
+// WatchSignupJob sends the result of each step of a signup job as soon as it completes or fails.
+func (h *Handler) WatchSignupJob(request *grpc_signup_go.SignupJobRequest, stream grpc_signup_go.Signup_WatchSignupJobServer) error {
+	sErr := h.checkPresharedSecret(stream.Context(), request.PresharedSecret)
+	if sErr != nil {
+		log.Error().Str("trace", conversions.ToDerror(sErr).DebugReport()).Msg("error validating secret")
+		return sErr
+	}
+	vErr := entities.ValidSignupJobRequest(request)
+	if vErr != nil {
+		return vErr
+	}
+	return h.Jobs.Watch(stream.Context(), request.JobId, stream.Send)
+}
+
+// ListOrganizations returns a page of the organizations in the system.
 func (h *Handler) ListOrganizations(ctx context.Context, request *grpc_signup_go.SignupInfoRequest) (*grpc_signup_go.OrganizationsList, error) {
-	sErr := h.checkPresharedSecret(request.PresharedSecret)
+	sErr := h.checkPresharedSecret(ctx, request.PresharedSecret)
 	if sErr != nil {
 		log.Error().Str("trace", conversions.ToDerror(sErr).DebugReport()).Msg("error validating secret")
 		return nil, sErr
 	}
-	return h.Manager.ListOrganizations(request)
+	vErr := entities.ValidListOrganizationsRequest(request)
+	if vErr != nil {
+		return nil, vErr
+	}
+	return h.Manager.ListOrganizations(ctx, request)
 }
 
 // GetOrganizationInfo retrieves the information about an organization.
 func (h *Handler) GetOrganizationInfo(ctx context.Context, request *grpc_signup_go.SignupInfoRequest) (*grpc_signup_go.OrganizationInfo, error) {
-	sErr := h.checkPresharedSecret(request.PresharedSecret)
+	sErr := h.checkPresharedSecret(ctx, request.PresharedSecret)
 	if sErr != nil {
 		log.Error().Str("trace", conversions.ToDerror(sErr).DebugReport()).Msg("error validating secret")
 		return nil, sErr
@@ -93,14 +203,34 @@ func (h *Handler) GetOrganizationInfo(ctx context.Context, request *grpc_signup_
 	}
 	vErr := entities.ValidOrganizationId(organizationID)
 	if vErr != nil {
-		return nil, conversions.ToGRPCError(vErr)
+		return nil, vErr
 	}
-	return h.Manager.GetOrganizationInfo(organizationID)
+	return h.Manager.GetOrganizationInfo(ctx, organizationID)
 }
 
-// DeleteOrganization removes an organization from the system.
+// GetOrganizationDetailedInfo retrieves the information about an organization with its clusters, application
+// descriptors, application instances and the number of users of each role.
+func (h *Handler) GetOrganizationDetailedInfo(ctx context.Context, request *grpc_signup_go.SignupInfoRequest) (*grpc_signup_go.OrganizationDetailedInfo, error) {
+	sErr := h.checkPresharedSecret(ctx, request.PresharedSecret)
+	if sErr != nil {
+		log.Error().Str("trace", conversions.ToDerror(sErr).DebugReport()).Msg("error validating secret")
+		return nil, sErr
+	}
+	organizationID := &grpc_organization_go.OrganizationId{
+		OrganizationId: request.OrganizationId,
+	}
+	vErr := entities.ValidOrganizationId(organizationID)
+	if vErr != nil {
+		return nil, vErr
+	}
+	return h.Manager.GetOrganizationDetailedInfo(ctx, organizationID)
+}
+
+// RemoveOrganization removes an organization from the system. If the organization cannot be completely removed, the
+// error contains the outcome of each executed step. On success the outcome is only logged, as the response carries
+// no report.
 func (h *Handler) RemoveOrganization(ctx context.Context, request *grpc_signup_go.SignupInfoRequest) (*grpc_common_go.Success, error) {
-	sErr := h.checkPresharedSecret(request.PresharedSecret)
+	sErr := h.checkPresharedSecret(ctx, request.PresharedSecret)
 	if sErr != nil {
 		log.Error().Str("trace", conversions.ToDerror(sErr).DebugReport()).Msg("error validating secret")
 		return nil, sErr
@@ -110,9 +240,13 @@ func (h *Handler) RemoveOrganization(ctx context.Context, request *grpc_signup_g
 	}
 	vErr := entities.ValidOrganizationId(organizationID)
 	if vErr != nil {
-		return nil, conversions.ToGRPCError(vErr)
+		return nil, vErr
+	}
+	report, err := h.Manager.RemoveOrganization(ctx, organizationID)
+	if report != nil {
+		log.Info().Str("organizationID", report.OrganizationID).Bool("completed", report.Completed).
+			Str("report", report.String()).Msg("organization removal report")
 	}
-	err := h.Manager.RemoveOrganization(organizationID)
 	if err != nil {
 		return nil, err
 	}
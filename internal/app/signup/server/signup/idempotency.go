@@ -0,0 +1,224 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-signup-go"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/metadata"
+)
+
+// IdempotencyKeyMetadataKey is the metadata key that contains the idempotency key of a signup request.
+const IdempotencyKeyMetadataKey = "idempotency-key"
+
+// MaxIdempotencyKeyLength is the maximum length of an idempotency key.
+const MaxIdempotencyKeyLength = 255
+
+// ReservationTimeout is the time after which a key whose signup is still in progress is released, in case the
+// signup has been lost without releasing it.
+const ReservationTimeout = 10 * time.Minute
+
+// idempotencyKey returns the idempotency key of the request, if any.
+func idempotencyKey(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(IdempotencyKeyMetadataKey); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// signupFingerprint returns a hash of the payload of a signup request. The preshared secret is not part of the
+// payload so it can be rotated between retries, and neither are the passwords, as the fingerprints may be persisted
+// and an unsalted hash could be used to recover them.
+func signupFingerprint(signupRequest *grpc_signup_go.SignupOrganizationRequest) string {
+	payload := *signupRequest
+	payload.PresharedSecret = ""
+	payload.OwnerPassword = ""
+	payload.NalejadminPassword = ""
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		// The request only contains basic types so this should never happen.
+		log.Error().Err(err).Msg("cannot serialize signup request")
+	}
+	hash := sha256.Sum256(raw)
+	return hex.EncodeToString(hash[:])
+}
+
+// idempotencyEntry contains the result of a signup associated with an idempotency key.
+type idempotencyEntry struct {
+	Fingerprint    string    `json:"fingerprint"`
+	OrganizationID string    `json:"organization_id"`
+	Created        time.Time `json:"created"`
+	// AppliedSettings and FailedSettings contain the result of the settings step of the signup.
+	AppliedSettings []string `json:"applied_settings"`
+	FailedSettings  []string `json:"failed_settings"`
+	// RoleIDs contains the identifiers of the roles created by the signup indexed by name.
+	RoleIDs map[string]string `json:"role_ids"`
+	// inProgress is true while the signup is being executed. Entries in progress are not persisted.
+	inProgress bool
+}
+
+// IdempotencyStore keeps the result of the signups associated with an idempotency key for a given time. The
+// completed entries are optionally persisted on a file so they survive restarts. Each instance of the service has
+// its own store, so keys are not shared between replicas.
+type IdempotencyStore struct {
+	sync.Mutex
+	ttl time.Duration
+	// reservationTimeout is the time a key can be in progress.
+	reservationTimeout time.Duration
+	path               string
+	entries            map[string]*idempotencyEntry
+}
+
+// NewIdempotencyStore creates a store whose entries expire after the given time. If the path is not empty, the
+// entries are loaded from and persisted on that file.
+func NewIdempotencyStore(ttl time.Duration, path string) (*IdempotencyStore, derrors.Error) {
+	store := &IdempotencyStore{
+		ttl:                ttl,
+		reservationTimeout: ReservationTimeout,
+		path:               path,
+		entries:            make(map[string]*idempotencyEntry, 0),
+	}
+	if path == "" {
+		return store, nil
+	}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read idempotency store")
+	}
+	if err := json.Unmarshal(raw, &store.entries); err != nil {
+		return nil, derrors.AsError(err, "cannot parse idempotency store")
+	}
+	store.purge(time.Now())
+	log.Info().Int("entries", len(store.entries)).Str("path", path).Msg("idempotency store loaded")
+	return store, nil
+}
+
+// Reserve registers a signup with the given key. If a signup with the same key has already been completed, its
+// response is returned. Otherwise the key is reserved until Complete or Release are called.
+func (is *IdempotencyStore) Reserve(key string, fingerprint string) (*grpc_signup_go.SignupOrganizationResponse, derrors.Error) {
+	is.Lock()
+	defer is.Unlock()
+	now := time.Now()
+	is.purge(now)
+	entry, exists := is.entries[key]
+	if !exists {
+		is.entries[key] = &idempotencyEntry{Fingerprint: fingerprint, Created: now, inProgress: true}
+		return nil, nil
+	}
+	if entry.Fingerprint != fingerprint {
+		return nil, derrors.NewInvalidArgumentError("idempotency key has already been used with a different request")
+	}
+	if entry.inProgress {
+		return nil, derrors.NewUnavailableError("a signup with the same idempotency key is in progress")
+	}
+	return &grpc_signup_go.SignupOrganizationResponse{
+		OrganizationId:  entry.OrganizationID,
+		AppliedSettings: entry.AppliedSettings,
+		FailedSettings:  entry.FailedSettings,
+		RoleIds:         entry.RoleIDs,
+	}, nil
+}
+
+// Complete records the response of the signup with the given key.
+func (is *IdempotencyStore) Complete(key string, response *grpc_signup_go.SignupOrganizationResponse) {
+	is.Lock()
+	defer is.Unlock()
+	entry, exists := is.entries[key]
+	if !exists {
+		return
+	}
+	entry.OrganizationID = response.OrganizationId
+	entry.AppliedSettings = response.AppliedSettings
+	entry.FailedSettings = response.FailedSettings
+	entry.RoleIDs = response.RoleIds
+	entry.inProgress = false
+	if err := is.persist(); err != nil {
+		log.Error().Str("trace", err.DebugReport()).Msg("cannot persist idempotency store")
+	}
+}
+
+// Release removes the reservation of a key whose signup has failed so it can be retried.
+func (is *IdempotencyStore) Release(key string) {
+	is.Lock()
+	defer is.Unlock()
+	if entry, exists := is.entries[key]; exists && entry.inProgress {
+		delete(is.entries, key)
+	}
+}
+
+// purge removes the completed entries that have expired and the reservations that have been in progress for too
+// long.
+func (is *IdempotencyStore) purge(now time.Time) {
+	for key, entry := range is.entries {
+		ttl := is.ttl
+		if entry.inProgress {
+			ttl = is.reservationTimeout
+		}
+		if now.Sub(entry.Created) > ttl {
+			delete(is.entries, key)
+		}
+	}
+}
+
+// persist writes the completed entries on the store file, if any.
+func (is *IdempotencyStore) persist() derrors.Error {
+	if is.path == "" {
+		return nil
+	}
+	completed := make(map[string]*idempotencyEntry, len(is.entries))
+	for key, entry := range is.entries {
+		if !entry.inProgress {
+			completed[key] = entry
+		}
+	}
+	raw, err := json.Marshal(completed)
+	if err != nil {
+		return derrors.AsError(err, "cannot serialize idempotency store")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(is.path), filepath.Base(is.path))
+	if err != nil {
+		return derrors.AsError(err, "cannot create idempotency store file")
+	}
+	_, err = tmp.Write(raw)
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), is.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return derrors.AsError(err, "cannot write idempotency store file")
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-signup-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Idempotency store", func() {
+
+	var store *IdempotencyStore
+	response := &grpc_signup_go.SignupOrganizationResponse{
+		OrganizationId:  "org-1",
+		AppliedSettings: []string{"DEFAULT_STORAGE_SIZE"},
+		FailedSettings:  []string{},
+		RoleIds:         map[string]string{OwnerRoleName: "role-1"},
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err derrors.Error
+		store, err = NewIdempotencyStore(time.Hour, "")
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should replay a completed signup", func() {
+		previous, err := store.Reserve("key", "fingerprint")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(previous).To(gomega.BeNil())
+		store.Complete("key", response)
+		previous, err = store.Reserve("key", "fingerprint")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(previous).To(gomega.Equal(response))
+	})
+
+	ginkgo.It("should reject a key used with a different request", func() {
+		_, err := store.Reserve("key", "fingerprint")
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = store.Reserve("key", "other")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(err.Type()).To(gomega.Equal(derrors.InvalidArgument))
+	})
+
+	ginkgo.It("should reject a key whose signup is in progress until it is released", func() {
+		_, err := store.Reserve("key", "fingerprint")
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = store.Reserve("key", "fingerprint")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		store.Release("key")
+		_, err = store.Reserve("key", "fingerprint")
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should expire reservations that have been in progress for too long", func() {
+		store.reservationTimeout = 10 * time.Millisecond
+		_, err := store.Reserve("key", "fingerprint")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Eventually(func() derrors.Error {
+			_, err := store.Reserve("key", "fingerprint")
+			return err
+		}).Should(gomega.Succeed())
+	})
+
+	ginkgo.It("should expire completed signups after the TTL", func() {
+		store.ttl = 10 * time.Millisecond
+		_, err := store.Reserve("key", "fingerprint")
+		gomega.Expect(err).To(gomega.Succeed())
+		store.Complete("key", response)
+		gomega.Eventually(func() *grpc_signup_go.SignupOrganizationResponse {
+			previous, _ := store.Reserve("key", "fingerprint")
+			return previous
+		}).Should(gomega.BeNil())
+	})
+
+	ginkgo.It("should not release completed signups", func() {
+		_, err := store.Reserve("key", "fingerprint")
+		gomega.Expect(err).To(gomega.Succeed())
+		store.Complete("key", response)
+		store.Release("key")
+		previous, err := store.Reserve("key", "fingerprint")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(previous).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("should persist the completed signups", func() {
+		dir, tErr := ioutil.TempDir("", "idempotency")
+		gomega.Expect(tErr).To(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "store.json")
+		store, err := NewIdempotencyStore(time.Hour, path)
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = store.Reserve("completed", "fingerprint")
+		gomega.Expect(err).To(gomega.Succeed())
+		store.Complete("completed", response)
+		_, err = store.Reserve("in-progress", "fingerprint")
+		gomega.Expect(err).To(gomega.Succeed())
+
+		loaded, err := NewIdempotencyStore(time.Hour, path)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(loaded.entries).To(gomega.HaveLen(1))
+		previous, err := loaded.Reserve("completed", "fingerprint")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(previous).To(gomega.Equal(response))
+	})
+
+	ginkgo.It("should not include the secrets in the fingerprint", func() {
+		request := &grpc_signup_go.SignupOrganizationRequest{OrganizationName: "acme", OwnerPassword: "owner"}
+		retry := *request
+		retry.OwnerPassword = "other"
+		retry.NalejadminPassword = "admin"
+		retry.PresharedSecret = "secret"
+		gomega.Expect(signupFingerprint(&retry)).To(gomega.Equal(signupFingerprint(request)))
+		retry.OrganizationName = "other"
+		gomega.Expect(signupFingerprint(&retry)).NotTo(gomega.Equal(signupFingerprint(request)))
+	})
+
+	ginkgo.It("should release the key if the signup panics", func() {
+		// The manager has no template catalog, so the signup panics.
+		handler := &Handler{Manager: Manager{inFlight: &inFlightSignups{}}, Idempotency: store}
+		request := &grpc_signup_go.SignupOrganizationRequest{OrganizationName: "acme"}
+		gomega.Expect(func() {
+			_, _ = handler.idempotentSignup(context.Background(), "key", request)
+		}).To(gomega.Panic())
+		_, err := store.Reserve("key", signupFingerprint(request))
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+})
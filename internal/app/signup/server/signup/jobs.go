@@ -0,0 +1,327 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-signup-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+)
+
+// newJobID generates a random job identifier.
+func newJobID() (string, derrors.Error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", derrors.AsError(err, "cannot generate job identifier")
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// signupJob contains the state of a signup executed in background.
+type signupJob struct {
+	id  string
+	ctx context.Context
+	// request is released once the job finishes, as it contains the passwords of the users.
+	request *grpc_signup_go.SignupOrganizationRequest
+	status  grpc_signup_go.SignupJobStatus
+	// organizationID contains the identifier of the organization once the signup has succeeded.
+	organizationID string
+	err            string
+	steps          []*grpc_signup_go.SignupJobStep
+	created        time.Time
+	updated        time.Time
+	// changed is closed and replaced every time the job is updated to wake up the watchers.
+	changed chan struct{}
+}
+
+// finished checks if the job has succeeded or failed.
+func (sj *signupJob) finished() bool {
+	return sj.status == grpc_signup_go.SignupJobStatus_SUCCEEDED || sj.status == grpc_signup_go.SignupJobStatus_FAILED
+}
+
+// toGRPC returns a copy of the job state.
+func (sj *signupJob) toGRPC() *grpc_signup_go.SignupJob {
+	steps := make([]*grpc_signup_go.SignupJobStep, len(sj.steps))
+	copy(steps, sj.steps)
+	return &grpc_signup_go.SignupJob{
+		JobId:          sj.id,
+		Status:         sj.status,
+		OrganizationId: sj.organizationID,
+		Error:          sj.err,
+		Steps:          steps,
+		Created:        sj.created.Unix(),
+		Updated:        sj.updated.Unix(),
+	}
+}
+
+// JobManager executes signups in background using a pool of workers. Finished jobs are kept for a given time so
+// their result can be retrieved.
+type JobManager struct {
+	sync.Mutex
+	manager *Manager
+	workers int
+	ttl     time.Duration
+	queue   chan *signupJob
+	jobs    map[string]*signupJob
+	// stop is closed when the manager stops accepting jobs.
+	stop    chan struct{}
+	stopped bool
+	// running tracks the workers, that finish once the manager is stopped and their current job is done.
+	running sync.WaitGroup
+}
+
+// NewJobManager creates a JobManager with the given number of workers and pending jobs.
+func NewJobManager(manager *Manager, workers int, queueSize int, ttl time.Duration) *JobManager {
+	return &JobManager{
+		manager: manager,
+		workers: workers,
+		ttl:     ttl,
+		queue:   make(chan *signupJob, queueSize),
+		jobs:    make(map[string]*signupJob, 0),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Start launches the workers.
+func (jm *JobManager) Start() {
+	jm.running.Add(jm.workers)
+	for i := 0; i < jm.workers; i++ {
+		go jm.work()
+	}
+}
+
+// Stop rejects new jobs, fails the pending ones and waits for the jobs being executed, that are not interrupted. It
+// returns false if the context is done before the running jobs have finished.
+func (jm *JobManager) Stop(ctx context.Context) bool {
+	jm.Lock()
+	if !jm.stopped {
+		jm.stopped = true
+		close(jm.stop)
+	}
+	jm.Unlock()
+	for pending := true; pending; {
+		select {
+		case job := <-jm.queue:
+			jm.cancel(job)
+		default:
+			pending = false
+		}
+	}
+	finished := make(chan struct{})
+	go func() {
+		jm.running.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Submit queues a new signup job. The job keeps the metadata of the request context but it is not cancelled with it.
+func (jm *JobManager) Submit(ctx context.Context, signupRequest *grpc_signup_go.SignupOrganizationRequest) (*grpc_signup_go.SignupJob, derrors.Error) {
+	if _, err := jm.manager.templates.Template(signupRequest.Plan); err != nil {
+		return nil, err
+	}
+	jobID, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	job := &signupJob{
+		id:      jobID,
+		ctx:     detachedMetadata(ctx),
+		request: signupRequest,
+		status:  grpc_signup_go.SignupJobStatus_QUEUED,
+		steps:   make([]*grpc_signup_go.SignupJobStep, 0),
+		created: now,
+		updated: now,
+		changed: make(chan struct{}),
+	}
+	jm.Lock()
+	defer jm.Unlock()
+	if jm.stopped {
+		return nil, derrors.NewUnavailableError("service is shutting down")
+	}
+	jm.purge(now)
+	select {
+	case jm.queue <- job:
+	default:
+		return nil, derrors.NewResourceExhaustedError("too many pending signup jobs")
+	}
+	jm.jobs[job.id] = job
+	log.Debug().Str("jobID", job.id).Str("organization", signupRequest.OrganizationName).Msg("signup job queued")
+	return job.toGRPC(), nil
+}
+
+// Get returns the current state of a job.
+func (jm *JobManager) Get(jobID string) (*grpc_signup_go.SignupJob, derrors.Error) {
+	jm.Lock()
+	defer jm.Unlock()
+	job, exists := jm.jobs[jobID]
+	if !exists {
+		return nil, derrors.NewNotFoundError("signup job not found").WithParams(jobID)
+	}
+	return job.toGRPC(), nil
+}
+
+// Watch sends an event for each step of a job, including the ones already completed, until the job finishes or the
+// context is done. The last event contains the final status of the job.
+func (jm *JobManager) Watch(ctx context.Context, jobID string, send func(*grpc_signup_go.SignupJobEvent) error) error {
+	jm.Lock()
+	job, exists := jm.jobs[jobID]
+	jm.Unlock()
+	if !exists {
+		return derrors.NewNotFoundError("signup job not found").WithParams(jobID)
+	}
+	sent := 0
+	for {
+		jm.Lock()
+		steps := job.steps[sent:]
+		status := job.status
+		organizationID := job.organizationID
+		jobErr := job.err
+		changed := job.changed
+		jm.Unlock()
+
+		for _, step := range steps {
+			if err := send(&grpc_signup_go.SignupJobEvent{JobId: jobID, Status: status, Step: step}); err != nil {
+				return err
+			}
+			sent++
+		}
+		if status == grpc_signup_go.SignupJobStatus_SUCCEEDED || status == grpc_signup_go.SignupJobStatus_FAILED {
+			return send(&grpc_signup_go.SignupJobEvent{
+				JobId:          jobID,
+				Status:         status,
+				OrganizationId: organizationID,
+				Error:          jobErr,
+			})
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// work executes the queued jobs until the manager is stopped.
+func (jm *JobManager) work() {
+	defer jm.running.Done()
+	for {
+		select {
+		case <-jm.stop:
+			return
+		case job := <-jm.queue:
+			select {
+			case <-jm.stop:
+				jm.cancel(job)
+				return
+			default:
+				jm.run(job)
+			}
+		}
+	}
+}
+
+// cancel fails a job that has not been started.
+func (jm *JobManager) cancel(job *signupJob) {
+	jm.finish(job, "", "signup job cancelled, service is shutting down")
+}
+
+// run executes the signup of a job, recording the result of each step. A panic fails the job instead of stopping
+// the service.
+func (jm *JobManager) run(job *signupJob) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Error().Str("jobID", job.id).Interface("panic", p).Str("stack", string(debug.Stack())).
+				Msg("recovered from panic in signup job")
+			jm.finish(job, "", derrors.NewInternalError("internal error executing the signup").Error())
+		}
+	}()
+	jm.update(job, func() {
+		job.status = grpc_signup_go.SignupJobStatus_RUNNING
+	})
+	log.Debug().Str("jobID", job.id).Msg("signup job started")
+	observer := func(step string, err error) {
+		result := &grpc_signup_go.SignupJobStep{
+			Name:      step,
+			Success:   err == nil,
+			Timestamp: time.Now().Unix(),
+		}
+		if err != nil {
+			result.Error = conversions.ToDerror(err).Error()
+		}
+		jm.update(job, func() {
+			job.steps = append(job.steps, result)
+		})
+	}
+	signupResult, err := jm.manager.ObservedSignupOrganization(job.ctx, job.request, observer)
+	if err != nil {
+		log.Warn().Str("jobID", job.id).Str("trace", conversions.ToDerror(err).DebugReport()).Msg("signup job failed")
+		jm.finish(job, "", conversions.ToDerror(err).Error())
+		return
+	}
+	organizationID := signupResult.Organization.OrganizationId
+	log.Info().Str("jobID", job.id).Str("organizationID", organizationID).
+		Strs("failedSettings", signupResult.FailedSettings).Msg("signup job succeeded")
+	jm.finish(job, organizationID, "")
+}
+
+// finish records the final result of a job and releases its request.
+func (jm *JobManager) finish(job *signupJob, organizationID string, jobErr string) {
+	jm.update(job, func() {
+		job.request = nil
+		job.organizationID = organizationID
+		job.err = jobErr
+		if jobErr == "" {
+			job.status = grpc_signup_go.SignupJobStatus_SUCCEEDED
+		} else {
+			job.status = grpc_signup_go.SignupJobStatus_FAILED
+		}
+	})
+}
+
+// update modifies a job and wakes up its watchers.
+func (jm *JobManager) update(job *signupJob, apply func()) {
+	jm.Lock()
+	defer jm.Unlock()
+	apply()
+	job.updated = time.Now()
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+// purge removes the finished jobs that have expired.
+func (jm *JobManager) purge(now time.Time) {
+	for id, job := range jm.jobs {
+		if job.finished() && now.Sub(job.updated) > jm.ttl {
+			delete(jm.jobs, id)
+		}
+	}
+}
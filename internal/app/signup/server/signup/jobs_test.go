@@ -0,0 +1,88 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+	"time"
+
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-organization-manager-go"
+	"github.com/nalej/grpc-signup-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+)
+
+// panickingOrgClient panics when an organization is created.
+type panickingOrgClient struct {
+	grpc_organization_manager_go.OrganizationsClient
+}
+
+func (poc *panickingOrgClient) AddOrganization(ctx context.Context, in *grpc_organization_go.AddOrganizationRequest, opts ...grpc.CallOption) (*grpc_organization_manager_go.Organization, error) {
+	panic("unexpected organization")
+}
+
+var _ = ginkgo.Describe("Signup jobs", func() {
+
+	var manager Manager
+	var jobs *JobManager
+	request := &grpc_signup_go.SignupOrganizationRequest{OrganizationName: "acme", OwnerPassword: "secret"}
+
+	// finishedJob waits until a job has finished and returns its state.
+	finishedJob := func(jobID string) *grpc_signup_go.SignupJob {
+		var job *grpc_signup_go.SignupJob
+		gomega.Eventually(func() grpc_signup_go.SignupJobStatus {
+			current, err := jobs.Get(jobID)
+			gomega.Expect(err).To(gomega.Succeed())
+			job = current
+			return job.Status
+		}, time.Second, 5*time.Millisecond).Should(gomega.Equal(grpc_signup_go.SignupJobStatus_FAILED))
+		return job
+	}
+
+	ginkgo.BeforeEach(func() {
+		manager = NewManager(&panickingOrgClient{}, nil, nil, nil, nil, &DefaultRoleCatalog, &DefaultTemplateCatalog, Timeouts{}, 1, nil)
+		jobs = NewJobManager(&manager, 1, 10, time.Hour)
+		jobs.Start()
+	})
+
+	ginkgo.AfterEach(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gomega.Expect(jobs.Stop(ctx)).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should fail a job that panics and keep executing the next ones", func() {
+		first, err := jobs.Submit(context.Background(), request)
+		gomega.Expect(err).To(gomega.Succeed())
+		second, err := jobs.Submit(context.Background(), request)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(finishedJob(first.JobId).Error).To(gomega.ContainSubstring("internal error"))
+		gomega.Expect(finishedJob(second.JobId).Error).To(gomega.ContainSubstring("internal error"))
+		gomega.Expect(manager.Drain(context.Background())).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should release the request once the job has finished", func() {
+		submitted, err := jobs.Submit(context.Background(), request)
+		gomega.Expect(err).To(gomega.Succeed())
+		finishedJob(submitted.JobId)
+		jobs.Lock()
+		defer jobs.Unlock()
+		gomega.Expect(jobs.jobs[submitted.JobId].request).To(gomega.BeNil())
+	})
+})
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-organization-manager-go"
+	"github.com/nalej/grpc-signup-go"
+)
+
+// encodePageToken returns the token of the page starting at the given position.
+func encodePageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodePageToken returns the position of the page of a token. An empty token is the first page.
+func decodePageToken(token string) (int, derrors.Error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, derrors.NewInvalidArgumentError("invalid page token")
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, derrors.NewInvalidArgumentError("invalid page token")
+	}
+	return offset, nil
+}
+
+// organizationInfo returns the information of an organization with the number of clusters, application descriptors
+// and application instances marked as unavailable until they are retrieved.
+func organizationInfo(org *grpc_organization_manager_go.Organization) *grpc_signup_go.OrganizationInfo {
+	return &grpc_signup_go.OrganizationInfo{
+		OrganizationId:    org.OrganizationId,
+		Name:              org.Name,
+		Created:           org.Created,
+		NumberUsers:       org.NumUsers,
+		NumberClusters:    UnavailableCount,
+		NumberDescriptors: UnavailableCount,
+		NumberInstances:   UnavailableCount,
+	}
+}
+
+// matchesFilters checks if an organization matches the name and creation filters of a list request.
+func matchesFilters(org *grpc_organization_manager_go.Organization, request *grpc_signup_go.SignupInfoRequest) bool {
+	if request.NameFilter != "" && !strings.Contains(strings.ToLower(org.Name), strings.ToLower(request.NameFilter)) {
+		return false
+	}
+	if request.CreatedAfter != 0 && org.Created < request.CreatedAfter {
+		return false
+	}
+	if request.CreatedBefore != 0 && org.Created >= request.CreatedBefore {
+		return false
+	}
+	return true
+}
+
+// requiresResources checks if the number of clusters and application instances of every organization is required
+// to filter or sort the organizations.
+func requiresResources(request *grpc_signup_go.SignupInfoRequest) bool {
+	return request.HasClusters != grpc_signup_go.ClusterFilter_ANY ||
+		request.SortBy == grpc_signup_go.OrganizationSortKey_NUMBER_CLUSTERS ||
+		request.SortBy == grpc_signup_go.OrganizationSortKey_NUMBER_INSTANCES
+}
+
+// filterByClusters removes the organizations that do not match the cluster filter. The organizations whose clusters
+// are unavailable are kept as they cannot be discarded.
+func filterByClusters(infos []*grpc_signup_go.OrganizationInfo, filter grpc_signup_go.ClusterFilter) []*grpc_signup_go.OrganizationInfo {
+	if filter == grpc_signup_go.ClusterFilter_ANY {
+		return infos
+	}
+	result := make([]*grpc_signup_go.OrganizationInfo, 0, len(infos))
+	for _, info := range infos {
+		if info.NumberClusters == UnavailableCount ||
+			(filter == grpc_signup_go.ClusterFilter_WITH_CLUSTERS) == (info.NumberClusters > 0) {
+			result = append(result, info)
+		}
+	}
+	return result
+}
+
+// sortOrganizations sorts the organizations by the given key. Organizations with the same key are sorted by
+// identifier so the pages are consistent between requests. The default key keeps the order of the organization
+// manager.
+func sortOrganizations(infos []*grpc_signup_go.OrganizationInfo, key grpc_signup_go.OrganizationSortKey, descending bool) {
+	var less func(a *grpc_signup_go.OrganizationInfo, b *grpc_signup_go.OrganizationInfo) bool
+	switch key {
+	case grpc_signup_go.OrganizationSortKey_NAME:
+		less = func(a *grpc_signup_go.OrganizationInfo, b *grpc_signup_go.OrganizationInfo) bool {
+			return a.Name < b.Name
+		}
+	case grpc_signup_go.OrganizationSortKey_CREATED:
+		less = func(a *grpc_signup_go.OrganizationInfo, b *grpc_signup_go.OrganizationInfo) bool {
+			return a.Created < b.Created
+		}
+	case grpc_signup_go.OrganizationSortKey_NUMBER_USERS:
+		less = func(a *grpc_signup_go.OrganizationInfo, b *grpc_signup_go.OrganizationInfo) bool {
+			return a.NumberUsers < b.NumberUsers
+		}
+	case grpc_signup_go.OrganizationSortKey_NUMBER_CLUSTERS:
+		less = func(a *grpc_signup_go.OrganizationInfo, b *grpc_signup_go.OrganizationInfo) bool {
+			return a.NumberClusters < b.NumberClusters
+		}
+	case grpc_signup_go.OrganizationSortKey_NUMBER_INSTANCES:
+		less = func(a *grpc_signup_go.OrganizationInfo, b *grpc_signup_go.OrganizationInfo) bool {
+			return a.NumberInstances < b.NumberInstances
+		}
+	default:
+		if descending {
+			for i, j := 0, len(infos)-1; i < j; i, j = i+1, j-1 {
+				infos[i], infos[j] = infos[j], infos[i]
+			}
+		}
+		return
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		if descending {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return a.OrganizationId < b.OrganizationId
+	})
+}
+
+// paginate returns the page of organizations starting at the given position and the token of the next page, empty
+// if it is the last one. A page size of zero returns every organization from that position.
+func paginate(infos []*grpc_signup_go.OrganizationInfo, offset int, pageSize int) ([]*grpc_signup_go.OrganizationInfo, string) {
+	if offset >= len(infos) {
+		return make([]*grpc_signup_go.OrganizationInfo, 0), ""
+	}
+	end := len(infos)
+	if pageSize > 0 && offset+pageSize < end {
+		end = offset + pageSize
+	}
+	next := ""
+	if end < len(infos) {
+		next = encodePageToken(end)
+	}
+	return infos[offset:end], next
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"github.com/nalej/grpc-organization-manager-go"
+	"github.com/nalej/grpc-signup-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// organizationIDs returns the identifiers of a list of organizations.
+func organizationIDs(infos []*grpc_signup_go.OrganizationInfo) []string {
+	ids := make([]string, 0, len(infos))
+	for _, info := range infos {
+		ids = append(ids, info.OrganizationId)
+	}
+	return ids
+}
+
+var _ = ginkgo.Describe("Organization listing", func() {
+
+	var infos []*grpc_signup_go.OrganizationInfo
+
+	ginkgo.BeforeEach(func() {
+		infos = []*grpc_signup_go.OrganizationInfo{
+			{OrganizationId: "c", Name: "Gamma", Created: 30, NumberUsers: 2, NumberClusters: 0, NumberInstances: 5},
+			{OrganizationId: "a", Name: "Alpha", Created: 10, NumberUsers: 2, NumberClusters: 3, NumberInstances: 1},
+			{OrganizationId: "d", Name: "Delta", Created: 40, NumberUsers: 1, NumberClusters: UnavailableCount, NumberInstances: UnavailableCount},
+			{OrganizationId: "b", Name: "Beta", Created: 20, NumberUsers: 4, NumberClusters: 1, NumberInstances: 0},
+		}
+	})
+
+	ginkgo.Context("page tokens", func() {
+		ginkgo.It("should decode the encoded positions", func() {
+			offset, err := decodePageToken(encodePageToken(25))
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(offset).To(gomega.Equal(25))
+		})
+
+		ginkgo.It("should start on the first page without token", func() {
+			offset, err := decodePageToken("")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(offset).To(gomega.BeZero())
+		})
+
+		ginkgo.It("should reject invalid tokens", func() {
+			for _, token := range []string{"not base64!", "YWJj", encodePageToken(-1)} {
+				_, err := decodePageToken(token)
+				gomega.Expect(err).NotTo(gomega.Succeed(), token)
+			}
+		})
+	})
+
+	ginkgo.Context("sorting", func() {
+		ginkgo.It("should keep the order of the organization manager by default", func() {
+			sortOrganizations(infos, grpc_signup_go.OrganizationSortKey_DEFAULT, false)
+			gomega.Expect(organizationIDs(infos)).To(gomega.Equal([]string{"c", "a", "d", "b"}))
+			sortOrganizations(infos, grpc_signup_go.OrganizationSortKey_DEFAULT, true)
+			gomega.Expect(organizationIDs(infos)).To(gomega.Equal([]string{"b", "d", "a", "c"}))
+		})
+
+		ginkgo.It("should sort by name and creation date", func() {
+			sortOrganizations(infos, grpc_signup_go.OrganizationSortKey_NAME, false)
+			gomega.Expect(organizationIDs(infos)).To(gomega.Equal([]string{"a", "b", "d", "c"}))
+			sortOrganizations(infos, grpc_signup_go.OrganizationSortKey_CREATED, true)
+			gomega.Expect(organizationIDs(infos)).To(gomega.Equal([]string{"d", "c", "b", "a"}))
+		})
+
+		ginkgo.It("should sort by identifier the organizations with the same key", func() {
+			sortOrganizations(infos, grpc_signup_go.OrganizationSortKey_NUMBER_USERS, false)
+			gomega.Expect(organizationIDs(infos)).To(gomega.Equal([]string{"d", "a", "c", "b"}))
+		})
+
+		ginkgo.It("should sort the unavailable counts first", func() {
+			sortOrganizations(infos, grpc_signup_go.OrganizationSortKey_NUMBER_CLUSTERS, false)
+			gomega.Expect(organizationIDs(infos)).To(gomega.Equal([]string{"d", "c", "b", "a"}))
+			sortOrganizations(infos, grpc_signup_go.OrganizationSortKey_NUMBER_INSTANCES, true)
+			gomega.Expect(organizationIDs(infos)).To(gomega.Equal([]string{"c", "a", "b", "d"}))
+		})
+	})
+
+	ginkgo.Context("pagination", func() {
+		ginkgo.It("should return the pages and the token of the next one", func() {
+			page, next := paginate(infos, 0, 3)
+			gomega.Expect(organizationIDs(page)).To(gomega.Equal([]string{"c", "a", "d"}))
+			offset, err := decodePageToken(next)
+			gomega.Expect(err).To(gomega.Succeed())
+			page, next = paginate(infos, offset, 3)
+			gomega.Expect(organizationIDs(page)).To(gomega.Equal([]string{"b"}))
+			gomega.Expect(next).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should return every organization without page size", func() {
+			page, next := paginate(infos, 1, 0)
+			gomega.Expect(page).To(gomega.HaveLen(3))
+			gomega.Expect(next).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should return an empty page after the last organization", func() {
+			page, next := paginate(infos, 10, 2)
+			gomega.Expect(page).To(gomega.BeEmpty())
+			gomega.Expect(next).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should not return a next page when the last page is full", func() {
+			_, next := paginate(infos, 2, 2)
+			gomega.Expect(next).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("filters", func() {
+		ginkgo.It("should filter by clusters keeping the organizations whose clusters are unavailable", func() {
+			gomega.Expect(organizationIDs(filterByClusters(infos, grpc_signup_go.ClusterFilter_WITH_CLUSTERS))).To(
+				gomega.Equal([]string{"a", "d", "b"}))
+			gomega.Expect(organizationIDs(filterByClusters(infos, grpc_signup_go.ClusterFilter_WITHOUT_CLUSTERS))).To(
+				gomega.Equal([]string{"c", "d"}))
+			gomega.Expect(filterByClusters(infos, grpc_signup_go.ClusterFilter_ANY)).To(gomega.HaveLen(4))
+		})
+
+		ginkgo.It("should filter by name ignoring case and by creation date", func() {
+			org := &grpc_organization_manager_go.Organization{Name: "Acme Corp", Created: 100}
+			gomega.Expect(matchesFilters(org, &grpc_signup_go.SignupInfoRequest{NameFilter: "acme"})).To(gomega.BeTrue())
+			gomega.Expect(matchesFilters(org, &grpc_signup_go.SignupInfoRequest{NameFilter: "nalej"})).To(gomega.BeFalse())
+			gomega.Expect(matchesFilters(org, &grpc_signup_go.SignupInfoRequest{CreatedAfter: 100, CreatedBefore: 101})).To(gomega.BeTrue())
+			gomega.Expect(matchesFilters(org, &grpc_signup_go.SignupInfoRequest{CreatedBefore: 100})).To(gomega.BeFalse())
+			gomega.Expect(matchesFilters(org, &grpc_signup_go.SignupInfoRequest{CreatedAfter: 101})).To(gomega.BeFalse())
+		})
+
+		ginkgo.It("should only require the resources to filter or sort by them", func() {
+			gomega.Expect(requiresResources(&grpc_signup_go.SignupInfoRequest{SortBy: grpc_signup_go.OrganizationSortKey_NAME})).To(gomega.BeFalse())
+			gomega.Expect(requiresResources(&grpc_signup_go.SignupInfoRequest{SortBy: grpc_signup_go.OrganizationSortKey_NUMBER_INSTANCES})).To(gomega.BeTrue())
+			gomega.Expect(requiresResources(&grpc_signup_go.SignupInfoRequest{HasClusters: grpc_signup_go.ClusterFilter_WITHOUT_CLUSTERS})).To(gomega.BeTrue())
+		})
+	})
+})
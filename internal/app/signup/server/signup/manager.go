@@ -19,6 +19,10 @@ package signup
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-application-go"
 	"github.com/nalej/grpc-authx-go"
@@ -27,52 +31,32 @@ import (
 	"github.com/nalej/grpc-organization-go"
 	"github.com/nalej/grpc-organization-manager-go"
 	"github.com/nalej/grpc-signup-go"
+	"github.com/nalej/grpc-user-go"
 	"github.com/nalej/grpc-user-manager-go"
 	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/nalej/signup/internal/app/signup/server/metrics"
 	"github.com/rs/zerolog/log"
 )
 
-const DefaultStorageAllocationSize = 100 * 1024 * 1024
-const DefaultStorageAllocationSizeDesc = "Default Storage Size (bytes)"
-
-// DefaultRoles defines the map of roles that will be automatically created by the system by default.
-var DefaultRoles = map[string][]grpc_authx_go.AccessPrimitive{
-	"Owner": {
-		grpc_authx_go.AccessPrimitive_ORG,
-	},
-	"Operator": {
-		grpc_authx_go.AccessPrimitive_PROFILE,
-		grpc_authx_go.AccessPrimitive_RESOURCES,
-	},
-	"Developer": {
-		grpc_authx_go.AccessPrimitive_PROFILE,
-		grpc_authx_go.AccessPrimitive_APPS,
-	},
-	"AppCluster": {
-		grpc_authx_go.AccessPrimitive_APPCLUSTEROPS,
-	},
-	"NalejAdmin": {
-		grpc_authx_go.AccessPrimitive_ORG,
-		grpc_authx_go.AccessPrimitive_ORG_MNGT,
-		grpc_authx_go.AccessPrimitive_RESOURCES_MNGT,
-	},
-}
-
-// InternalRoles contains the relationship of which roles are application managed (no human involved).
-var InternalRoles = map[string]bool{
-	"Owner":      false,
-	"Operator":   false,
-	"Developer":  false,
-	"NalejAdmin": false,
-	"AppCluster": true,
-}
-
 // Manager structure with the required providers for cluster operations.
 type Manager struct {
 	OrgClient     grpc_organization_manager_go.OrganizationsClient
 	UserClient    grpc_user_manager_go.UserManagerClient
 	ClusterClient grpc_infrastructure_go.ClustersClient
+	NodeClient    grpc_infrastructure_go.NodesClient
 	AppClient     grpc_application_go.ApplicationsClient
+	// roles contains the roles that can be created on a new organization.
+	roles *RoleCatalog
+	// templates contains the roles, settings and users created on a new organization depending on its plan.
+	templates *TemplateCatalog
+	// timeouts of the requests sent to other components.
+	timeouts Timeouts
+	// listConcurrency is the maximum number of organizations whose information is retrieved concurrently.
+	listConcurrency int
+	// resources caches the resources of the organizations, nil if disabled.
+	resources *ResourceCache
+	// inFlight tracks the signups being processed.
+	inFlight *inFlightSignups
 }
 
 // NewManager creates a Manager using a set of providers.
@@ -80,187 +64,454 @@ func NewManager(
 	orgClient grpc_organization_manager_go.OrganizationsClient,
 	userClient grpc_user_manager_go.UserManagerClient,
 	clusterClient grpc_infrastructure_go.ClustersClient,
+	nodeClient grpc_infrastructure_go.NodesClient,
 	appClient grpc_application_go.ApplicationsClient,
+	roles *RoleCatalog,
+	templates *TemplateCatalog,
+	timeouts Timeouts,
+	listConcurrency int,
+	resources *ResourceCache,
 ) Manager {
-	return Manager{orgClient, userClient, clusterClient, appClient}
+	return Manager{orgClient, userClient, clusterClient, nodeClient, appClient, roles, templates, timeouts, listConcurrency,
+		resources, &inFlightSignups{}}
+}
+
+// inFlightSignups tracks the signups being processed. Once draining has started new signups are rejected, so the
+// wait group is never incremented while it is being waited.
+type inFlightSignups struct {
+	sync.Mutex
+	signups  sync.WaitGroup
+	draining bool
 }
 
-func (m *Manager) SignupOrganization(signupRequest *grpc_signup_go.SignupOrganizationRequest) (*grpc_organization_manager_go.Organization, error) {
-
-	addOrganizationRequest := &grpc_organization_go.AddOrganizationRequest{
-		Name:        signupRequest.OrganizationName,
-		Email:       signupRequest.OrganizationEmail,
-		FullAddress: signupRequest.OrganizationFullAddress,
-		City:        signupRequest.OrganizationCity,
-		State:       signupRequest.OrganizationState,
-		Country:     signupRequest.OrganizationCountry,
-		ZipCode:     signupRequest.OrganizationZipCode,
-		PhotoBase64: signupRequest.OrganizationPhotoBase64,
+// begin registers a new signup. It returns false if the signups are being drained.
+func (ifs *inFlightSignups) begin() bool {
+	ifs.Lock()
+	defer ifs.Unlock()
+	if ifs.draining {
+		return false
 	}
-	orgCreated, err := m.OrgClient.AddOrganization(context.Background(), addOrganizationRequest)
-	if err != nil {
-		log.Error().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("error creating organization")
-		return nil, err
+	ifs.signups.Add(1)
+	return true
+}
+
+// end unregisters a signup that has finished or rolled back.
+func (ifs *inFlightSignups) end() {
+	ifs.signups.Done()
+}
+
+// drain rejects new signups and returns a channel that is closed once the registered ones have finished.
+func (ifs *inFlightSignups) drain() <-chan struct{} {
+	ifs.Lock()
+	ifs.draining = true
+	ifs.Unlock()
+	drained := make(chan struct{})
+	go func() {
+		ifs.signups.Wait()
+		close(drained)
+	}()
+	return drained
+}
+
+// Drain rejects new signups and waits until the in-flight ones have finished or rolled back. It returns false if the
+// context is done before that. It can be called again to keep waiting.
+func (m *Manager) Drain(ctx context.Context) bool {
+	drained := m.inFlight.drain()
+	select {
+	case <-drained:
+		return true
+	case <-ctx.Done():
+		return false
 	}
-	log.Debug().Str("organizationID", orgCreated.OrganizationId).Msg("Organization has been created")
+}
 
-	// create organization settings
-	_, err = m.OrgClient.AddSetting(context.Background(), &grpc_organization_go.AddSettingRequest{
-		OrganizationId: orgCreated.OrganizationId,
-		Key:            grpc_organization_go.AllowedSettingKey_DEFAULT_STORAGE_SIZE.String(),
-		Value:          fmt.Sprintf("%d", DefaultStorageAllocationSize),
-		Description:    DefaultStorageAllocationSizeDesc,
-	})
-	if err != nil {
-		log.Error().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("error creating settings")
-	} else {
-		log.Debug().Str("organizationID", orgCreated.OrganizationId).Str("setting", grpc_organization_go.AllowedSettingKey_DEFAULT_STORAGE_SIZE.String()).Msg("Setting added")
+// SignupResult contains the outcome of a successful signup.
+type SignupResult struct {
+	Organization *grpc_organization_manager_go.Organization
+	// AppliedSettings contains the keys of the settings that have been created.
+	AppliedSettings []string
+	// FailedSettings contains the keys of the best-effort settings that could not be created.
+	FailedSettings []string
+	// RoleIDs contains the identifiers of the roles that have been created indexed by name.
+	RoleIDs map[string]string
+}
+
+// toGRPC returns the signup response.
+func (sr *SignupResult) toGRPC() *grpc_signup_go.SignupOrganizationResponse {
+	return &grpc_signup_go.SignupOrganizationResponse{
+		OrganizationId:  sr.Organization.OrganizationId,
+		AppliedSettings: sr.AppliedSettings,
+		FailedSettings:  sr.FailedSettings,
+		RoleIds:         sr.RoleIDs,
 	}
+}
 
-	ownerRoleID, nalejAdminRoleID, err := m.createRoles(orgCreated.OrganizationId)
-	if err != nil {
-		// TODO Rollback required
-		log.Error().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("error creating roles")
-		return nil, err
+// StepObserver is notified each time a signup step completes or fails.
+type StepObserver func(step string, err error)
+
+// notify reports the result of a step to the observer, if any.
+func (so StepObserver) notify(step string, err error) {
+	if so != nil {
+		so(step, err)
+	}
+}
+
+// SignupOrganization creates a new organization with the settings, roles, Nalej administrator and owner of its plan.
+// If any step fails, the steps already applied are reverted in reverse order.
+func (m *Manager) SignupOrganization(ctx context.Context, signupRequest *grpc_signup_go.SignupOrganizationRequest) (*SignupResult, error) {
+	return m.ObservedSignupOrganization(ctx, signupRequest, nil)
+}
+
+// ObservedSignupOrganization creates a new organization like SignupOrganization, notifying the observer of the
+// result of each step.
+func (m *Manager) ObservedSignupOrganization(ctx context.Context, signupRequest *grpc_signup_go.SignupOrganizationRequest, observer StepObserver) (result *SignupResult, err error) {
+	if !m.inFlight.begin() {
+		return nil, derrors.NewUnavailableError("service is shutting down")
 	}
+	defer m.inFlight.end()
+	defer func() {
+		metrics.ObserveSignup(err)
+	}()
 
-	// Add Nalej administrator
-	addNalejAdminRequest := &grpc_user_manager_go.AddUserRequest{
-		OrganizationId: orgCreated.OrganizationId,
-		Email:          signupRequest.NalejadminEmail,
-		Password:       signupRequest.NalejadminPassword,
-		Name:           signupRequest.NalejadminName,
-		LastName:       signupRequest.NalejadminLastName,
-		Title:          signupRequest.NalejadminTitle,
-		RoleId:         *nalejAdminRoleID,
+	template, tErr := m.templates.Template(signupRequest.Plan)
+	if tErr != nil {
+		return nil, tErr
 	}
-	err = addUser(err, m, addNalejAdminRequest, orgCreated)
+	return m.executePlan(ctx, newSignupPlan(signupRequest, m.roles, template), observer)
+}
+
+// executePlan creates the organization, settings, roles and users of a signup plan. If any step fails, except for
+// best-effort settings, the steps already applied are reverted in reverse order.
+func (m *Manager) executePlan(ctx context.Context, plan *signupPlan, observer StepObserver) (*SignupResult, error) {
+	start := time.Now()
+	orgCtx, cancel := m.organizationManagerContext(ctx)
+	orgCreated, err := m.OrgClient.AddOrganization(orgCtx, plan.organization)
+	cancel()
+	metrics.ObserveStep("organization", start, err)
+	observer.notify("organization", err)
 	if err != nil {
+		log.Error().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("error creating organization")
 		return nil, err
 	}
+	log.Debug().Str("organizationID", orgCreated.OrganizationId).Msg("Organization has been created")
+	// Whatever the result, the resources of the organization may have been listed while it was being created.
+	defer m.resources.Invalidate(orgCreated.OrganizationId)
+	plan.setOrganizationID(orgCreated.OrganizationId)
+	rollback := newSignupRollback(ctx, orgCreated.OrganizationId)
+	rollback.Add("organization", func(ctx context.Context) error {
+		return m.removeOrganization(ctx, orgCreated.OrganizationId)
+	})
+
+	result := &SignupResult{
+		Organization:    orgCreated,
+		AppliedSettings: make([]string, 0, len(plan.settings)),
+		FailedSettings:  make([]string, 0),
+	}
 
-	// Add owner
-	addOwnerRequest := &grpc_user_manager_go.AddUserRequest{
-		OrganizationId: orgCreated.OrganizationId,
-		Email:          signupRequest.OwnerEmail,
-		Password:       signupRequest.OwnerPassword,
-		Name:           signupRequest.OwnerName,
-		LastName:       signupRequest.OwnerLastName,
-		Title:          signupRequest.OwnerTitle,
-		RoleId:         *ownerRoleID,
+	// create organization settings
+	for _, setting := range plan.settings {
+		settingKey := setting.request.Key
+		start = time.Now()
+		settingCtx, cancel := m.organizationManagerContext(ctx)
+		_, err = m.OrgClient.AddSetting(settingCtx, setting.request)
+		cancel()
+		metrics.ObserveStep("setting", start, err)
+		observer.notify(fmt.Sprintf("setting %s", settingKey), err)
+		if err != nil {
+			log.Error().Str("setting", settingKey).Bool("required", setting.required).
+				Str("trace", conversions.ToDerror(err).DebugReport()).Msg("error creating settings")
+			if setting.required {
+				return nil, rollback.Fail(err, fmt.Sprintf("cannot create setting %s", settingKey))
+			}
+			result.FailedSettings = append(result.FailedSettings, settingKey)
+			continue
+		}
+		result.AppliedSettings = append(result.AppliedSettings, settingKey)
+		log.Debug().Str("organizationID", orgCreated.OrganizationId).Str("setting", settingKey).Msg("Setting added")
+		rollback.Add(fmt.Sprintf("setting %s", settingKey), func(ctx context.Context) error {
+			return m.removeSetting(ctx, orgCreated.OrganizationId, settingKey)
+		})
 	}
-	err = addUser(err, m, addOwnerRequest, orgCreated)
+
+	start = time.Now()
+	roleIDs, err := m.createRoles(ctx, plan.roles, rollback, observer)
+	metrics.ObserveStep("roles", start, err)
 	if err != nil {
-		return nil, err
+		log.Error().Str("trace", conversions.ToDerror(err).DebugReport()).Msg("error creating roles")
+		return nil, rollback.Fail(err, "cannot create roles")
 	}
-	return orgCreated, nil
-}
+	result.RoleIDs = roleIDs
 
-func (m *Manager) createRoles(organizationID string) (*string, *string, error) {
-	var ownerRoleID string
-	var nalejAdminRoleID string
-	for name, primitives := range DefaultRoles {
-		internal, found := InternalRoles[name]
+	for _, user := range plan.users {
+		roleID, found := roleIDs[user.roleName]
 		if !found {
-			return nil, nil, derrors.NewInternalError("cannot determine if role is internal")
-		}
-		addRoleRequest := &grpc_user_manager_go.AddRoleRequest{
-			OrganizationId: organizationID,
-			Name:           name,
-			Description:    "Auto generate role",
-			Internal:       internal,
-			Primitives:     primitives,
+			return nil, rollback.Fail(derrors.NewInternalError("role has not been created").WithParams(user.roleName),
+				fmt.Sprintf("cannot create %s", user.step))
 		}
-		added, err := m.UserClient.AddRole(context.Background(), addRoleRequest)
+		user.request.RoleId = roleID
+		start = time.Now()
+		err = m.addUser(ctx, user.request, rollback)
+		metrics.ObserveStep(user.step, start, err)
+		observer.notify(fmt.Sprintf("user %s", user.request.Email), err)
 		if err != nil {
-			return nil, nil, err
+			return nil, rollback.Fail(err, fmt.Sprintf("cannot create %s", user.step))
 		}
-		switch name {
-		case "Owner":
-			ownerRoleID = added.RoleId
-		case "NalejAdmin":
-			nalejAdminRoleID = added.RoleId
+	}
+	return result, nil
+}
+
+// createRoles creates the roles of an organization in the order of the plan, registering the removal of each role in
+// the rollback. It returns the identifiers of the roles indexed by name.
+func (m *Manager) createRoles(ctx context.Context, roles []*grpc_user_manager_go.AddRoleRequest, rollback *signupRollback, observer StepObserver) (map[string]string, error) {
+	roleIDs := make(map[string]string, len(roles))
+	for _, addRoleRequest := range roles {
+		roleCtx, cancel := m.userManagerContext(ctx)
+		added, err := m.UserClient.AddRole(roleCtx, addRoleRequest)
+		cancel()
+		observer.notify(fmt.Sprintf("role %s", addRoleRequest.Name), err)
+		if err != nil {
+			return nil, err
 		}
+		organizationID := addRoleRequest.OrganizationId
+		roleID := added.RoleId
+		rollback.Add(fmt.Sprintf("role %s", addRoleRequest.Name), func(ctx context.Context) error {
+			return m.removeRole(ctx, organizationID, roleID)
+		})
+		roleIDs[addRoleRequest.Name] = added.RoleId
 		log.Debug().Str("organizationID", organizationID).Str("roleID", added.RoleId).Msg("Role has been created")
 	}
-	return &ownerRoleID, &nalejAdminRoleID, nil
+	return roleIDs, nil
 }
 
-// ListOrganizations returns the list of organizations in the system.
-func (m *Manager) ListOrganizations(request *grpc_signup_go.SignupInfoRequest) (*grpc_signup_go.OrganizationsList, error) {
-	orgs, err := m.OrgClient.ListOrganizations(context.Background(), &grpc_common_go.Empty{})
+// UnavailableCount is the number of clusters, application descriptors or application instances reported for an
+// organization when they cannot be retrieved.
+const UnavailableCount = -1
+
+// ListOrganizations returns a page of the organizations in the system matching the filters of the request, sorted
+// by the given key. The information of the organizations is retrieved concurrently, up to the list concurrency of
+// the manager. The organizations whose information cannot be retrieved are still returned, with the error and the
+// missing counts marked as unavailable.
+func (m *Manager) ListOrganizations(ctx context.Context, request *grpc_signup_go.SignupInfoRequest) (*grpc_signup_go.OrganizationsList, error) {
+	offset, tErr := decodePageToken(request.PageToken)
+	if tErr != nil {
+		return nil, tErr
+	}
+	orgCtx, cancel := m.organizationManagerContext(ctx)
+	defer cancel()
+	orgs, err := m.OrgClient.ListOrganizations(orgCtx, &grpc_common_go.Empty{})
 	if err != nil {
 		return nil, err
 	}
-	result := make([]*grpc_signup_go.OrganizationInfo, 0, len(orgs.Organizations))
+
+	infos := make([]*grpc_signup_go.OrganizationInfo, 0, len(orgs.Organizations))
 	for _, org := range orgs.Organizations {
-		info, err := m.extendOrganizationInfo(org)
-		if err != nil {
-			return nil, err
+		if matchesFilters(org, request) {
+			infos = append(infos, organizationInfo(org))
 		}
-		result = append(result, info)
+	}
+	// The resources of every organization are only retrieved if they are needed to filter or sort the organizations,
+	// otherwise only the ones of the requested page are retrieved.
+	resources := requiresResources(request)
+	if resources {
+		m.extendOrganizations(ctx, infos)
+		infos = filterByClusters(infos, request.HasClusters)
+	}
+	sortOrganizations(infos, request.SortBy, request.SortDescending)
+	page, next := paginate(infos, offset, int(request.PageSize))
+	if !resources {
+		m.extendOrganizations(ctx, page)
 	}
 	return &grpc_signup_go.OrganizationsList{
-		Organizations: result,
-	}, err
+		Organizations: page,
+		NextPageToken: next,
+		TotalSize:     int32(len(infos)),
+	}, nil
 }
 
-func (m *Manager) extendOrganizationInfo(org *grpc_organization_manager_go.Organization) (*grpc_signup_go.OrganizationInfo, error) {
+// extendOrganizations retrieves the resources of a set of organizations concurrently, up to the list concurrency of
+// the manager.
+func (m *Manager) extendOrganizations(ctx context.Context, infos []*grpc_signup_go.OrganizationInfo) {
+	slots := make(chan struct{}, m.listConcurrency)
+	var wg sync.WaitGroup
+	for _, info := range infos {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(info *grpc_signup_go.OrganizationInfo) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			m.extendOrganizationInfo(ctx, info)
+		}(info)
+	}
+	wg.Wait()
+}
+
+// resourceLists contains the clusters, application descriptors and application instances of an organization, and
+// the errors found retrieving them.
+type resourceLists struct {
+	// generation is the generation of the organization in the cache when the resources were requested.
+	generation    uint64
+	clusters      *grpc_infrastructure_go.ClusterList
+	descriptors   *grpc_application_go.AppDescriptorList
+	instances     *grpc_application_go.AppInstanceList
+	clusterErr    error
+	descriptorErr error
+	instanceErr   error
+}
+
+// failures logs and describes the resources that could not be retrieved.
+func (rl *resourceLists) failures(organizationID string) []string {
+	failures := make([]string, 0)
+	for _, failure := range []struct {
+		name string
+		err  error
+	}{{"clusters", rl.clusterErr}, {"application descriptors", rl.descriptorErr}, {"application instances", rl.instanceErr}} {
+		if failure.err != nil {
+			log.Warn().Str("organizationID", organizationID).Str("resource", failure.name).
+				Str("trace", conversions.ToDerror(failure.err).DebugReport()).Msg("cannot retrieve organization resources")
+			failures = append(failures, fmt.Sprintf("cannot retrieve %s: %s", failure.name, conversions.ToDerror(failure.err).Error()))
+		}
+	}
+	return failures
+}
+
+// listResources retrieves the clusters, application descriptors and application instances of an organization. The
+// three requests are sent concurrently.
+func (m *Manager) listResources(ctx context.Context, organizationID string) *resourceLists {
 	orgID := &grpc_organization_go.OrganizationId{
-		OrganizationId: org.OrganizationId,
+		OrganizationId: organizationID,
 	}
+	lists := &resourceLists{generation: m.resources.generation(organizationID)}
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		clusterCtx, cancel := m.systemModelContext(ctx)
+		defer cancel()
+		lists.clusters, lists.clusterErr = m.ClusterClient.ListClusters(clusterCtx, orgID)
+	}()
+	go func() {
+		defer wg.Done()
+		descriptorCtx, cancel := m.systemModelContext(ctx)
+		defer cancel()
+		lists.descriptors, lists.descriptorErr = m.AppClient.ListAppDescriptors(descriptorCtx, orgID)
+	}()
+	go func() {
+		defer wg.Done()
+		instanceCtx, cancel := m.systemModelContext(ctx)
+		defer cancel()
+		lists.instances, lists.instanceErr = m.AppClient.ListAppInstances(instanceCtx, orgID)
+	}()
+	wg.Wait()
+	return lists
+}
 
-	clusters, err := m.ClusterClient.ListClusters(context.Background(), orgID)
-	if err != nil {
-		return nil, err
+// extendOrganizationInfo retrieves the number of clusters, application descriptors and application instances of an
+// organization, from the cache if possible. The counts that cannot be retrieved are left as UnavailableCount and the
+// errors are reported in the information of the organization.
+func (m *Manager) extendOrganizationInfo(ctx context.Context, info *grpc_signup_go.OrganizationInfo) {
+	if cached, found := m.resources.get(info.OrganizationId); found {
+		info.NumberClusters = cached.clusters
+		info.NumberDescriptors = cached.descriptors
+		info.NumberInstances = cached.instances
+		return
 	}
-	descriptors, err := m.AppClient.ListAppDescriptors(context.Background(), orgID)
-	if err != nil {
-		return nil, err
+	m.applyResources(info, m.listResources(ctx, info.OrganizationId))
+}
+
+// applyResources fills the counts of the resources retrieved, and the errors of the ones that could not be
+// retrieved. Only complete results are cached, if the organization has not been invalidated while retrieving them.
+func (m *Manager) applyResources(info *grpc_signup_go.OrganizationInfo, lists *resourceLists) {
+	if lists.clusterErr == nil {
+		info.NumberClusters = int32(len(lists.clusters.Clusters))
 	}
-	instances, err := m.AppClient.ListAppInstances(context.Background(), orgID)
-	if err != nil {
-		return nil, err
+	if lists.descriptorErr == nil {
+		info.NumberDescriptors = int32(len(lists.descriptors.Descriptors))
 	}
-	return &grpc_signup_go.OrganizationInfo{
-		OrganizationId:    org.OrganizationId,
-		Name:              org.Name,
-		Created:           org.Created,
-		NumberUsers:       org.NumUsers,
-		NumberClusters:    int32(len(clusters.Clusters)),
-		NumberDescriptors: int32(len(descriptors.Descriptors)),
-		NumberInstances:   int32(len(instances.Instances)),
-	}, nil
+	if lists.instanceErr == nil {
+		info.NumberInstances = int32(len(lists.instances.Instances))
+	}
+	failures := lists.failures(info.OrganizationId)
+	if len(failures) > 0 {
+		info.Error = strings.Join(failures, "; ")
+		return
+	}
+	m.resources.put(info.OrganizationId, lists.generation, organizationResources{
+		clusters:    info.NumberClusters,
+		descriptors: info.NumberDescriptors,
+		instances:   info.NumberInstances,
+	})
 }
 
 // GetOrganizationInfo retrieves the information about an organization.
-func (m *Manager) GetOrganizationInfo(organizationID *grpc_organization_go.OrganizationId) (*grpc_signup_go.OrganizationInfo, error) {
-	org, err := m.OrgClient.GetOrganization(context.Background(), organizationID)
+func (m *Manager) GetOrganizationInfo(ctx context.Context, organizationID *grpc_organization_go.OrganizationId) (*grpc_signup_go.OrganizationInfo, error) {
+	orgCtx, cancel := m.organizationManagerContext(ctx)
+	defer cancel()
+	org, err := m.OrgClient.GetOrganization(orgCtx, organizationID)
 	if err != nil {
 		return nil, err
 	}
-	return m.extendOrganizationInfo(org)
+	info := organizationInfo(org)
+	m.extendOrganizationInfo(ctx, info)
+	return info, nil
 }
 
-// DeleteOrganization removes an organization from the system.
-func (m *Manager) RemoveOrganization(organizationID *grpc_organization_go.OrganizationId) error {
-	log.Info().Str("organizationID", organizationID.OrganizationId).Msg("Removing organization")
-	// Undeploy running apps
-	// Delete descriptors
-	// Delete nodes
-	// Delete clusters
-	// Delete users
-	// Delete roles
-	// Delete organization
-	panic("implement me")
-}
-
-func addUser(err error, m *Manager, addNalejAdminRequest *grpc_user_manager_go.AddUserRequest, orgCreated *grpc_organization_manager_go.Organization) error {
-	nalejAdminAdded, err := m.UserClient.AddUser(context.Background(), addNalejAdminRequest)
+// addUser creates a user of the organization, registering its removal in the rollback.
+func (m *Manager) addUser(ctx context.Context, addUserRequest *grpc_user_manager_go.AddUserRequest, rollback *signupRollback) error {
+	userCtx, cancel := m.userManagerContext(ctx)
+	defer cancel()
+	added, err := m.UserClient.AddUser(userCtx, addUserRequest)
 	if err != nil {
-		log.Error().Str("roleID", addNalejAdminRequest.RoleId).Str("trace", conversions.ToDerror(err).DebugReport()).Msg("error creating user")
+		log.Error().Str("roleID", addUserRequest.RoleId).Str("trace", conversions.ToDerror(err).DebugReport()).Msg("error creating user")
 		return err
 	}
-	log.Debug().Str("organizationID", orgCreated.OrganizationId).Str("role", nalejAdminAdded.RoleName).Msg("User has been created")
+	rollback.Add(fmt.Sprintf("user %s", addUserRequest.Email), func(ctx context.Context) error {
+		return m.removeUser(ctx, addUserRequest.OrganizationId, addUserRequest.Email)
+	})
+	log.Debug().Str("organizationID", addUserRequest.OrganizationId).Str("role", added.RoleName).Msg("User has been created")
 	return nil
 }
+
+// removeUser removes a user from an organization.
+func (m *Manager) removeUser(ctx context.Context, organizationID string, email string) error {
+	userCtx, cancel := m.userManagerContext(ctx)
+	defer cancel()
+	_, err := m.UserClient.RemoveUser(userCtx, &grpc_user_go.UserId{
+		OrganizationId: organizationID,
+		Email:          email,
+	})
+	return err
+}
+
+// removeRole removes a role from an organization.
+func (m *Manager) removeRole(ctx context.Context, organizationID string, roleID string) error {
+	userCtx, cancel := m.userManagerContext(ctx)
+	defer cancel()
+	_, err := m.UserClient.RemoveRole(userCtx, &grpc_authx_go.RoleId{
+		OrganizationId: organizationID,
+		RoleId:         roleID,
+	})
+	return err
+}
+
+// removeSetting removes a setting from an organization.
+func (m *Manager) removeSetting(ctx context.Context, organizationID string, key string) error {
+	orgCtx, cancel := m.organizationManagerContext(ctx)
+	defer cancel()
+	_, err := m.OrgClient.RemoveSetting(orgCtx, &grpc_organization_go.SettingKey{
+		OrganizationId: organizationID,
+		Key:            key,
+	})
+	return err
+}
+
+// removeOrganization removes the organization entry.
+func (m *Manager) removeOrganization(ctx context.Context, organizationID string) error {
+	orgCtx, cancel := m.organizationManagerContext(ctx)
+	defer cancel()
+	_, err := m.OrgClient.RemoveOrganization(orgCtx, &grpc_organization_go.OrganizationId{
+		OrganizationId: organizationID,
+	})
+	return err
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+
+	"github.com/nalej/grpc-signup-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// signupRequest returns a signup request of the acme organization.
+func signupRequest() *grpc_signup_go.SignupOrganizationRequest {
+	return &grpc_signup_go.SignupOrganizationRequest{
+		OrganizationName:   "acme",
+		OrganizationEmail:  "contact@acme.com",
+		OwnerEmail:         "owner@acme.com",
+		OwnerPassword:      "owner-password",
+		NalejadminEmail:    "admin@nalej.com",
+		NalejadminPassword: "admin-password",
+	}
+}
+
+var _ = ginkgo.Describe("Signup of organizations", func() {
+
+	var system *fakeSystem
+	var manager Manager
+
+	ginkgo.BeforeEach(func() {
+		system = newFakeSystem()
+		manager = system.manager(&DefaultRoleCatalog, &DefaultTemplateCatalog)
+	})
+
+	ginkgo.It("should not roll back anything if the organization cannot be created", func() {
+		system.fail("add organization acme", codes.AlreadyExists)
+		_, err := manager.SignupOrganization(context.Background(), signupRequest())
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.AlreadyExists))
+		gomega.Expect(system.recorded("remove")).To(gomega.BeEmpty())
+	})
+
+	table.DescribeTable("should roll back the applied steps in reverse order keeping the error code",
+		func(failed string, code codes.Code, compensations []string) {
+			system.fail(failed, code)
+			_, err := manager.SignupOrganization(context.Background(), signupRequest())
+			gomega.Expect(status.Code(err)).To(gomega.Equal(code))
+			gomega.Expect(system.recorded("remove")).To(gomega.Equal(compensations))
+		},
+		table.Entry("settings", "add setting DEFAULT_STORAGE_SIZE", codes.FailedPrecondition, []string{
+			"remove organization org-1",
+		}),
+		table.Entry("roles", "add role Developer", codes.Unavailable, []string{
+			"remove role role-operator",
+			"remove role role-owner",
+			"remove setting DEFAULT_STORAGE_SIZE",
+			"remove organization org-1",
+		}),
+		table.Entry("users", "add user owner@acme.com with role-owner", codes.InvalidArgument, []string{
+			"remove user admin@nalej.com",
+			"remove role role-nalejadmin",
+			"remove role role-appcluster",
+			"remove role role-developer",
+			"remove role role-operator",
+			"remove role role-owner",
+			"remove setting DEFAULT_STORAGE_SIZE",
+			"remove organization org-1",
+		}),
+	)
+
+	ginkgo.It("should keep rolling back and return the original error if a compensation fails", func() {
+		system.fail("add role Operator", codes.Unavailable)
+		system.fail("remove setting DEFAULT_STORAGE_SIZE", codes.Internal)
+		_, err := manager.SignupOrganization(context.Background(), signupRequest())
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unavailable))
+		gomega.Expect(system.recorded("remove")).To(gomega.Equal([]string{
+			"remove role role-owner",
+			"remove setting DEFAULT_STORAGE_SIZE",
+			"remove organization org-1",
+		}))
+	})
+
+	ginkgo.It("should create the roles in order and assign their identifiers to the users", func() {
+		result, err := manager.SignupOrganization(context.Background(), signupRequest())
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(system.recorded("add")).To(gomega.Equal([]string{
+			"add organization acme",
+			"add setting DEFAULT_STORAGE_SIZE",
+			"add role Owner",
+			"add role Operator",
+			"add role Developer",
+			"add role AppCluster",
+			"add role NalejAdmin",
+			"add user admin@nalej.com with role-nalejadmin",
+			"add user owner@acme.com with role-owner",
+		}))
+		gomega.Expect(result.RoleIDs).To(gomega.Equal(map[string]string{
+			"Owner":      "role-owner",
+			"Operator":   "role-operator",
+			"Developer":  "role-developer",
+			"AppCluster": "role-appcluster",
+			"NalejAdmin": "role-nalejadmin",
+		}))
+	})
+
+	ginkgo.It("should only create the roles of the template", func() {
+		template := DefaultTemplateCatalog.Templates[0]
+		template.Roles = []string{"Operator", NalejAdminRoleName}
+		template.Users = []TemplateUser{{User: NalejAdminUser, Role: NalejAdminRoleName}, {User: OwnerUser, Role: "Operator"}}
+		manager = system.manager(&DefaultRoleCatalog, &TemplateCatalog{Templates: []SignupTemplate{template}})
+		result, err := manager.SignupOrganization(context.Background(), signupRequest())
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(system.recorded("add role")).To(gomega.Equal([]string{"add role Operator", "add role NalejAdmin"}))
+		gomega.Expect(system.recorded("add user")).To(gomega.Equal([]string{
+			"add user admin@nalej.com with role-nalejadmin",
+			"add user owner@acme.com with role-operator",
+		}))
+		gomega.Expect(result.RoleIDs).To(gomega.HaveLen(2))
+	})
+
+	ginkgo.Context("with a best-effort setting", func() {
+
+		ginkgo.BeforeEach(func() {
+			template := DefaultTemplateCatalog.Templates[0]
+			template.Settings = []TemplateSetting{DefaultTemplateCatalog.Templates[0].Settings[0]}
+			template.Settings[0].Policy = SettingPolicyBestEffort
+			manager = system.manager(&DefaultRoleCatalog, &TemplateCatalog{Templates: []SignupTemplate{template}})
+		})
+
+		ginkgo.It("should apply the setting if it can be created", func() {
+			result, err := manager.SignupOrganization(context.Background(), signupRequest())
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.AppliedSettings).To(gomega.Equal([]string{"DEFAULT_STORAGE_SIZE"}))
+			gomega.Expect(result.FailedSettings).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should report the setting as failed without rolling back", func() {
+			system.fail("add setting DEFAULT_STORAGE_SIZE", codes.Unavailable)
+			result, err := manager.SignupOrganization(context.Background(), signupRequest())
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.AppliedSettings).To(gomega.BeEmpty())
+			gomega.Expect(result.FailedSettings).To(gomega.Equal([]string{"DEFAULT_STORAGE_SIZE"}))
+			gomega.Expect(system.recorded("remove")).To(gomega.BeEmpty())
+			gomega.Expect(system.recorded("add user")).To(gomega.HaveLen(2))
+		})
+	})
+
+	ginkgo.Context("with a required setting", func() {
+
+		ginkgo.It("should roll back the signup if the setting cannot be created", func() {
+			gomega.Expect(DefaultTemplateCatalog.Templates[0].Settings[0].Required()).To(gomega.BeTrue())
+			system.fail("add setting DEFAULT_STORAGE_SIZE", codes.Unavailable)
+			result, err := manager.SignupOrganization(context.Background(), signupRequest())
+			gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unavailable))
+			gomega.Expect(result).To(gomega.BeNil())
+			gomega.Expect(system.recorded("remove")).To(gomega.Equal([]string{"remove organization org-1"}))
+			gomega.Expect(system.recorded("add role")).To(gomega.BeEmpty())
+		})
+	})
+})
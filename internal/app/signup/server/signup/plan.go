@@ -0,0 +1,183 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-signup-go"
+	"github.com/nalej/grpc-user-manager-go"
+)
+
+// plannedUser contains a user to be created during the signup.
+type plannedUser struct {
+	// step is the name of the signup step that creates the user.
+	step     string
+	request  *grpc_user_manager_go.AddUserRequest
+	roleName string
+}
+
+// plannedSetting contains a setting to be created during the signup.
+type plannedSetting struct {
+	request *grpc_organization_go.AddSettingRequest
+	// required is true if the signup fails when the setting cannot be created.
+	required bool
+}
+
+// signupPlan contains the requests sent to other components to signup an organization. The organization identifier
+// of the requests is filled once the organization has been created, and the role identifier of the users once the
+// roles have been created.
+type signupPlan struct {
+	organization *grpc_organization_go.AddOrganizationRequest
+	settings     []plannedSetting
+	roles        []*grpc_user_manager_go.AddRoleRequest
+	users        []plannedUser
+}
+
+// newSignupPlan creates the plan to signup an organization with a template.
+func newSignupPlan(signupRequest *grpc_signup_go.SignupOrganizationRequest, roles *RoleCatalog, template *SignupTemplate) *signupPlan {
+	plan := &signupPlan{
+		organization: &grpc_organization_go.AddOrganizationRequest{
+			Name:        signupRequest.OrganizationName,
+			Email:       signupRequest.OrganizationEmail,
+			FullAddress: signupRequest.OrganizationFullAddress,
+			City:        signupRequest.OrganizationCity,
+			State:       signupRequest.OrganizationState,
+			Country:     signupRequest.OrganizationCountry,
+			ZipCode:     signupRequest.OrganizationZipCode,
+			PhotoBase64: signupRequest.OrganizationPhotoBase64,
+		},
+		settings: make([]plannedSetting, 0, len(template.Settings)),
+		roles:    make([]*grpc_user_manager_go.AddRoleRequest, 0, len(roles.Roles)),
+		users: []plannedUser{
+			{
+				step: NalejAdminUser,
+				request: &grpc_user_manager_go.AddUserRequest{
+					Email:    signupRequest.NalejadminEmail,
+					Password: signupRequest.NalejadminPassword,
+					Name:     signupRequest.NalejadminName,
+					LastName: signupRequest.NalejadminLastName,
+					Title:    signupRequest.NalejadminTitle,
+				},
+				roleName: template.UserRole(NalejAdminUser),
+			},
+			{
+				step: OwnerUser,
+				request: &grpc_user_manager_go.AddUserRequest{
+					Email:    signupRequest.OwnerEmail,
+					Password: signupRequest.OwnerPassword,
+					Name:     signupRequest.OwnerName,
+					LastName: signupRequest.OwnerLastName,
+					Title:    signupRequest.OwnerTitle,
+				},
+				roleName: template.UserRole(OwnerUser),
+			},
+		},
+	}
+	for _, setting := range template.Settings {
+		plan.settings = append(plan.settings, plannedSetting{
+			request: &grpc_organization_go.AddSettingRequest{
+				Key:         setting.Key,
+				Value:       setting.Value,
+				Description: setting.Description,
+			},
+			required: setting.Required(),
+		})
+	}
+	for _, role := range roles.Roles {
+		if !template.hasRole(role.Name) {
+			continue
+		}
+		plan.roles = append(plan.roles, &grpc_user_manager_go.AddRoleRequest{
+			Name:        role.Name,
+			Description: role.Description,
+			Internal:    role.Internal,
+			Primitives:  role.AccessPrimitives(),
+		})
+	}
+	return plan
+}
+
+// setOrganizationID fills the organization identifier of the requests once the organization has been created.
+func (sp *signupPlan) setOrganizationID(organizationID string) {
+	for _, setting := range sp.settings {
+		setting.request.OrganizationId = organizationID
+	}
+	for _, role := range sp.roles {
+		role.OrganizationId = organizationID
+	}
+	for _, user := range sp.users {
+		user.request.OrganizationId = organizationID
+	}
+}
+
+// toGRPC returns the plan without the passwords of the users.
+func (sp *signupPlan) toGRPC() *grpc_signup_go.SignupPlan {
+	settings := make([]*grpc_organization_go.AddSettingRequest, 0, len(sp.settings))
+	for _, setting := range sp.settings {
+		settings = append(settings, setting.request)
+	}
+	users := make([]*grpc_signup_go.SignupPlanUser, 0, len(sp.users))
+	for _, user := range sp.users {
+		request := *user.request
+		request.Password = ""
+		users = append(users, &grpc_signup_go.SignupPlanUser{
+			User:     &request,
+			RoleName: user.roleName,
+		})
+	}
+	return &grpc_signup_go.SignupPlan{
+		Organization: sp.organization,
+		Settings:     settings,
+		Roles:        sp.roles,
+		Users:        users,
+	}
+}
+
+// PlanSignupOrganization returns the organization, settings, roles and users that would be created by a signup
+// without creating anything. The signup is rejected if the name or email of the organization are already in use.
+func (m *Manager) PlanSignupOrganization(ctx context.Context, signupRequest *grpc_signup_go.SignupOrganizationRequest) (*grpc_signup_go.SignupPlan, error) {
+	template, err := m.templates.Template(signupRequest.Plan)
+	if err != nil {
+		return nil, err
+	}
+	plan := newSignupPlan(signupRequest, m.roles, template)
+	orgCtx, cancel := m.organizationManagerContext(ctx)
+	defer cancel()
+	orgs, lErr := m.OrgClient.ListOrganizations(orgCtx, &grpc_common_go.Empty{})
+	if lErr != nil {
+		return nil, lErr
+	}
+	conflicts := make([]string, 0)
+	for _, org := range orgs.Organizations {
+		if strings.EqualFold(org.Name, plan.organization.Name) {
+			conflicts = append(conflicts, fmt.Sprintf("name %s is used by organization %s", org.Name, org.OrganizationId))
+		}
+		if strings.EqualFold(org.Email, plan.organization.Email) {
+			conflicts = append(conflicts, fmt.Sprintf("email %s is used by organization %s", org.Email, org.OrganizationId))
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, derrors.NewAlreadyExistsError(fmt.Sprintf("organization conflicts: %s", strings.Join(conflicts, "; ")))
+	}
+	return plan.toGRPC(), nil
+}
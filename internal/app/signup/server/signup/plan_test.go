@@ -0,0 +1,88 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-organization-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = ginkgo.Describe("Signup plan", func() {
+
+	var system *fakeSystem
+	var manager Manager
+
+	// conflicts checks that the signup is rejected because the organization already exists, and returns the error.
+	conflicts := func(err error) string {
+		dErr, ok := err.(derrors.Error)
+		gomega.Expect(ok).To(gomega.BeTrue())
+		gomega.Expect(dErr.Type()).To(gomega.Equal(derrors.AlreadyExists))
+		return dErr.Error()
+	}
+
+	ginkgo.BeforeEach(func() {
+		system = newFakeSystem()
+		system.organizations = []*grpc_organization_manager_go.Organization{
+			{OrganizationId: "org-0", Name: "globex", Email: "contact@globex.com"},
+		}
+		manager = system.manager(&DefaultRoleCatalog, &DefaultTemplateCatalog)
+	})
+
+	ginkgo.It("should plan the signup without creating anything", func() {
+		plan, err := manager.PlanSignupOrganization(context.Background(), signupRequest())
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(plan.Organization.Name).To(gomega.Equal("acme"))
+		gomega.Expect(plan.Settings).To(gomega.HaveLen(1))
+		gomega.Expect(plan.Roles).To(gomega.HaveLen(len(DefaultRoleCatalog.Roles)))
+		gomega.Expect(plan.Users).To(gomega.HaveLen(2))
+		for _, user := range plan.Users {
+			gomega.Expect(user.User.Password).To(gomega.BeEmpty())
+		}
+		gomega.Expect(system.recorded("add")).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should reject an organization whose name is in use", func() {
+		request := signupRequest()
+		request.OrganizationName = "GLOBEX"
+		_, err := manager.PlanSignupOrganization(context.Background(), request)
+		message := conflicts(err)
+		gomega.Expect(message).To(gomega.ContainSubstring("name globex is used by organization org-0"))
+		gomega.Expect(message).NotTo(gomega.ContainSubstring("email"))
+	})
+
+	ginkgo.It("should report every conflict of the organization", func() {
+		request := signupRequest()
+		request.OrganizationName = "globex"
+		request.OrganizationEmail = "Contact@Globex.com"
+		_, err := manager.PlanSignupOrganization(context.Background(), request)
+		message := conflicts(err)
+		gomega.Expect(message).To(gomega.ContainSubstring("name globex is used by organization org-0"))
+		gomega.Expect(message).To(gomega.ContainSubstring("email contact@globex.com is used by organization org-0"))
+	})
+
+	ginkgo.It("should fail if the organizations cannot be listed", func() {
+		system.fail("list organizations", codes.Unavailable)
+		_, err := manager.PlanSignupOrganization(context.Background(), signupRequest())
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unavailable))
+	})
+})
@@ -0,0 +1,302 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/grpc-application-go"
+	"github.com/nalej/grpc-infrastructure-go"
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RemovalStep contains the outcome of one of the steps required to remove an organization.
+type RemovalStep struct {
+	// Name of the step.
+	Name string
+	// Removed contains the number of elements removed in this step.
+	Removed int
+	// Errors contains the description of the elements that could not be removed.
+	Errors []string
+	// cause is the first error of the step.
+	cause error
+}
+
+// fail records an error of the step.
+func (rs *RemovalStep) fail(description string, err error) {
+	rs.Errors = append(rs.Errors, fmt.Sprintf("%s: %s", description, conversions.ToDerror(err).Error()))
+	if rs.cause == nil {
+		rs.cause = err
+	}
+}
+
+// record updates the step with the result of removing an element.
+func (rs *RemovalStep) record(element string, err error) {
+	if err != nil {
+		rs.fail(element, err)
+		return
+	}
+	rs.Removed++
+}
+
+// String returns a human readable summary of the step.
+func (rs *RemovalStep) String() string {
+	if len(rs.Errors) == 0 {
+		return fmt.Sprintf("%s: %d removed", rs.Name, rs.Removed)
+	}
+	return fmt.Sprintf("%s: %d removed, %d failed [%s]", rs.Name, rs.Removed, len(rs.Errors), strings.Join(rs.Errors, "; "))
+}
+
+// RemovalReport contains the outcome of each step executed while removing an organization.
+type RemovalReport struct {
+	OrganizationID string
+	Steps          []RemovalStep
+	// Completed is true if the organization has been completely removed.
+	Completed bool
+}
+
+// String returns a human readable summary of the report.
+func (rr *RemovalReport) String() string {
+	steps := make([]string, 0, len(rr.Steps))
+	for _, step := range rr.Steps {
+		steps = append(steps, step.String())
+	}
+	return strings.Join(steps, ", ")
+}
+
+// RemovalError is returned when an organization cannot be completely removed. It keeps the code of the first error
+// of the failed step, and it is sent to gRPC clients with the outcome of each executed step as ResourceInfo details.
+type RemovalError struct {
+	Report *RemovalReport
+	// step is the step that could not be completed.
+	step *RemovalStep
+}
+
+// Error returns the failed step and the summary of the report.
+func (re *RemovalError) Error() string {
+	return fmt.Sprintf("organization removal stopped at step %s: %s", re.step.Name, re.Report.String())
+}
+
+// GRPCStatus returns a status with the code of the failed step and the outcome of each step as details.
+func (re *RemovalError) GRPCStatus() *status.Status {
+	code := codes.Internal
+	if re.step.cause != nil {
+		code = status.Code(conversions.ToGRPCError(conversions.ToDerror(re.step.cause)))
+	}
+	st := status.New(code, re.Error())
+	for _, step := range re.Report.Steps {
+		detailed, err := st.WithDetails(&errdetails.ResourceInfo{
+			ResourceType: "organization removal step",
+			ResourceName: step.Name,
+			Owner:        re.Report.OrganizationID,
+			Description:  step.String(),
+		})
+		if err != nil {
+			return st
+		}
+		st = detailed
+	}
+	return st
+}
+
+// removalStepFunc removes the elements of an organization associated with a step.
+type removalStepFunc func(ctx context.Context, organizationID *grpc_organization_go.OrganizationId, step *RemovalStep) error
+
+// RemoveOrganization removes an organization from the system. The elements of the organization are removed in
+// order, and the process stops on the first step that cannot be completed so that the organization entry is only
+// removed once it is empty. The returned report contains the outcome of each executed step, and the error is a
+// RemovalError with the same report if the organization has not been completely removed.
+func (m *Manager) RemoveOrganization(ctx context.Context, organizationID *grpc_organization_go.OrganizationId) (*RemovalReport, error) {
+	log.Info().Str("organizationID", organizationID.OrganizationId).Msg("Removing organization")
+	// Even if the removal fails, some of the resources of the organization may have been removed.
+	defer m.resources.Invalidate(organizationID.OrganizationId)
+	steps := []struct {
+		name   string
+		remove removalStepFunc
+	}{
+		{"instances", m.removeAppInstances},
+		{"descriptors", m.removeAppDescriptors},
+		{"nodes", m.removeNodes},
+		{"clusters", m.removeClusters},
+		{"users", m.removeUsers},
+		{"roles", m.removeRoles},
+		{"organization", m.removeOrganizationEntry},
+	}
+	report := &RemovalReport{
+		OrganizationID: organizationID.OrganizationId,
+		Steps:          make([]RemovalStep, 0, len(steps)),
+	}
+	for _, s := range steps {
+		step := RemovalStep{Name: s.name, Errors: make([]string, 0)}
+		err := s.remove(ctx, organizationID, &step)
+		if err != nil {
+			step.fail(fmt.Sprintf("cannot list %s", s.name), err)
+		}
+		report.Steps = append(report.Steps, step)
+		if len(step.Errors) > 0 {
+			log.Error().Str("organizationID", organizationID.OrganizationId).Str("step", step.String()).Msg("cannot remove organization")
+			return report, &RemovalError{Report: report, step: &report.Steps[len(report.Steps)-1]}
+		}
+		log.Debug().Str("organizationID", organizationID.OrganizationId).Str("step", step.String()).Msg("removal step completed")
+	}
+	report.Completed = true
+	log.Info().Str("organizationID", organizationID.OrganizationId).Msg("organization has been removed")
+	return report, nil
+}
+
+// removeAppInstances removes the application instances of an organization from System Model. The instances are not
+// undeployed, so their workloads keep running on the application clusters.
+func (m *Manager) removeAppInstances(ctx context.Context, organizationID *grpc_organization_go.OrganizationId, step *RemovalStep) error {
+	listCtx, cancel := m.systemModelContext(ctx)
+	instances, err := m.AppClient.ListAppInstances(listCtx, organizationID)
+	cancel()
+	if err != nil {
+		return err
+	}
+	for _, instance := range instances.Instances {
+		removeCtx, cancel := m.systemModelContext(ctx)
+		_, err := m.AppClient.RemoveAppInstance(removeCtx, &grpc_application_go.AppInstanceId{
+			OrganizationId: organizationID.OrganizationId,
+			AppInstanceId:  instance.AppInstanceId,
+		})
+		cancel()
+		step.record(instance.AppInstanceId, err)
+	}
+	return nil
+}
+
+// removeAppDescriptors removes the application descriptors of an organization.
+func (m *Manager) removeAppDescriptors(ctx context.Context, organizationID *grpc_organization_go.OrganizationId, step *RemovalStep) error {
+	listCtx, cancel := m.systemModelContext(ctx)
+	descriptors, err := m.AppClient.ListAppDescriptors(listCtx, organizationID)
+	cancel()
+	if err != nil {
+		return err
+	}
+	for _, descriptor := range descriptors.Descriptors {
+		removeCtx, cancel := m.systemModelContext(ctx)
+		_, err := m.AppClient.RemoveAppDescriptor(removeCtx, &grpc_application_go.AppDescriptorId{
+			OrganizationId:  organizationID.OrganizationId,
+			AppDescriptorId: descriptor.AppDescriptorId,
+		})
+		cancel()
+		step.record(descriptor.AppDescriptorId, err)
+	}
+	return nil
+}
+
+// removeNodes removes the nodes of every cluster of an organization.
+func (m *Manager) removeNodes(ctx context.Context, organizationID *grpc_organization_go.OrganizationId, step *RemovalStep) error {
+	listCtx, cancel := m.systemModelContext(ctx)
+	clusters, err := m.ClusterClient.ListClusters(listCtx, organizationID)
+	cancel()
+	if err != nil {
+		return err
+	}
+	for _, cluster := range clusters.Clusters {
+		nodesCtx, cancel := m.systemModelContext(ctx)
+		nodes, err := m.NodeClient.ListNodes(nodesCtx, &grpc_infrastructure_go.ClusterId{
+			OrganizationId: organizationID.OrganizationId,
+			ClusterId:      cluster.ClusterId,
+		})
+		cancel()
+		if err != nil {
+			step.record(cluster.ClusterId, err)
+			continue
+		}
+		if len(nodes.Nodes) == 0 {
+			continue
+		}
+		nodeIDs := make([]string, 0, len(nodes.Nodes))
+		for _, node := range nodes.Nodes {
+			nodeIDs = append(nodeIDs, node.NodeId)
+		}
+		removeCtx, cancel := m.systemModelContext(ctx)
+		_, err = m.NodeClient.RemoveNodes(removeCtx, &grpc_infrastructure_go.RemoveNodesRequest{
+			OrganizationId: organizationID.OrganizationId,
+			Nodes:          nodeIDs,
+		})
+		cancel()
+		if err != nil {
+			step.record(cluster.ClusterId, err)
+			continue
+		}
+		step.Removed += len(nodeIDs)
+	}
+	return nil
+}
+
+// removeClusters removes the clusters of an organization.
+func (m *Manager) removeClusters(ctx context.Context, organizationID *grpc_organization_go.OrganizationId, step *RemovalStep) error {
+	listCtx, cancel := m.systemModelContext(ctx)
+	clusters, err := m.ClusterClient.ListClusters(listCtx, organizationID)
+	cancel()
+	if err != nil {
+		return err
+	}
+	for _, cluster := range clusters.Clusters {
+		removeCtx, cancel := m.systemModelContext(ctx)
+		_, err := m.ClusterClient.RemoveCluster(removeCtx, &grpc_infrastructure_go.RemoveClusterRequest{
+			OrganizationId: organizationID.OrganizationId,
+			ClusterId:      cluster.ClusterId,
+		})
+		cancel()
+		step.record(cluster.ClusterId, err)
+	}
+	return nil
+}
+
+// removeUsers removes the users of an organization.
+func (m *Manager) removeUsers(ctx context.Context, organizationID *grpc_organization_go.OrganizationId, step *RemovalStep) error {
+	listCtx, cancel := m.userManagerContext(ctx)
+	users, err := m.UserClient.ListUsers(listCtx, organizationID)
+	cancel()
+	if err != nil {
+		return err
+	}
+	for _, user := range users.Users {
+		step.record(user.Email, m.removeUser(ctx, organizationID.OrganizationId, user.Email))
+	}
+	return nil
+}
+
+// removeRoles removes the roles of an organization.
+func (m *Manager) removeRoles(ctx context.Context, organizationID *grpc_organization_go.OrganizationId, step *RemovalStep) error {
+	listCtx, cancel := m.userManagerContext(ctx)
+	roles, err := m.UserClient.ListRoles(listCtx, organizationID)
+	cancel()
+	if err != nil {
+		return err
+	}
+	for _, role := range roles.Roles {
+		step.record(role.Name, m.removeRole(ctx, organizationID.OrganizationId, role.RoleId))
+	}
+	return nil
+}
+
+// removeOrganizationEntry removes the organization once all its elements have been removed.
+func (m *Manager) removeOrganizationEntry(ctx context.Context, organizationID *grpc_organization_go.OrganizationId, step *RemovalStep) error {
+	step.record(organizationID.OrganizationId, m.removeOrganization(ctx, organizationID.OrganizationId))
+	return nil
+}
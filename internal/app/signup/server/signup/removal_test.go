@@ -0,0 +1,153 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-application-go"
+	"github.com/nalej/grpc-infrastructure-go"
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-user-manager-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = ginkgo.Describe("Organization removal error", func() {
+
+	var report *RemovalReport
+
+	ginkgo.BeforeEach(func() {
+		report = &RemovalReport{OrganizationID: "org-1", Steps: []RemovalStep{{Name: "applications", Removed: 2}, {Name: "clusters"}}}
+	})
+
+	ginkgo.It("should keep the code of the failed step", func() {
+		failed := &report.Steps[1]
+		failed.record("cluster c1", derrors.NewNotFoundError("cluster c1"))
+		failed.record("cluster c2", derrors.NewInternalError("cannot uninstall"))
+		err := &RemovalError{Report: report, step: failed}
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.NotFound))
+	})
+
+	ginkgo.It("should return internal if the failed step has no cause", func() {
+		err := &RemovalError{Report: report, step: &report.Steps[1]}
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Internal))
+	})
+
+	ginkgo.It("should include the outcome of each step as details", func() {
+		report.Steps[1].record("cluster c1", derrors.NewUnavailableError("cannot connect"))
+		err := &RemovalError{Report: report, step: &report.Steps[1]}
+		details := status.Convert(err).Details()
+		gomega.Expect(details).To(gomega.HaveLen(2))
+		names := make([]string, 0, len(details))
+		for _, detail := range details {
+			info, ok := detail.(*errdetails.ResourceInfo)
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(info.Owner).To(gomega.Equal("org-1"))
+			names = append(names, info.ResourceName)
+		}
+		gomega.Expect(names).To(gomega.Equal([]string{"applications", "clusters"}))
+		gomega.Expect(details[1].(*errdetails.ResourceInfo).Description).To(gomega.ContainSubstring("1 failed"))
+	})
+})
+
+var _ = ginkgo.Describe("Organization removal", func() {
+
+	var system *fakeSystem
+	var manager Manager
+	organizationID := &grpc_organization_go.OrganizationId{OrganizationId: fakeOrganizationID}
+
+	ginkgo.BeforeEach(func() {
+		system = newFakeSystem()
+		system.instances = []*grpc_application_go.AppInstance{{AppInstanceId: "i1"}, {AppInstanceId: "i2"}}
+		system.descriptors = []*grpc_application_go.AppDescriptor{{AppDescriptorId: "d1"}}
+		system.clusters = []*grpc_infrastructure_go.Cluster{{ClusterId: "c1"}, {ClusterId: "c2"}}
+		system.nodes = []*grpc_infrastructure_go.Node{{ClusterId: "c1", NodeId: "n1"}, {ClusterId: "c1", NodeId: "n2"}}
+		system.users = []*grpc_user_manager_go.User{{Email: "owner@acme.com"}}
+		system.roles = []*grpc_user_manager_go.Role{{RoleId: "role-owner", Name: OwnerRoleName}}
+		manager = system.manager(&DefaultRoleCatalog, &DefaultTemplateCatalog)
+	})
+
+	// removed returns the number of elements removed by each step of a report.
+	removed := func(report *RemovalReport) map[string]int {
+		counts := make(map[string]int, len(report.Steps))
+		for _, step := range report.Steps {
+			counts[step.Name] = step.Removed
+		}
+		return counts
+	}
+
+	ginkgo.It("should remove the elements of the organization in order", func() {
+		report, err := manager.RemoveOrganization(context.Background(), organizationID)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(report.Completed).To(gomega.BeTrue())
+		gomega.Expect(system.recorded("remove")).To(gomega.Equal([]string{
+			"remove instance i1",
+			"remove instance i2",
+			"remove descriptor d1",
+			"remove nodes n1,n2",
+			"remove cluster c1",
+			"remove cluster c2",
+			"remove user owner@acme.com",
+			"remove role role-owner",
+			"remove organization org-1",
+		}))
+		gomega.Expect(removed(report)).To(gomega.Equal(map[string]int{
+			"instances": 2, "descriptors": 1, "nodes": 2, "clusters": 2, "users": 1, "roles": 1, "organization": 1,
+		}))
+	})
+
+	ginkgo.It("should complete the failed step and stop before the next one", func() {
+		system.fail("remove instance i1", codes.FailedPrecondition)
+		report, err := manager.RemoveOrganization(context.Background(), organizationID)
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.FailedPrecondition))
+		gomega.Expect(err.(*RemovalError).Report).To(gomega.Equal(report))
+		gomega.Expect(report.Completed).To(gomega.BeFalse())
+		gomega.Expect(system.recorded("remove")).To(gomega.Equal([]string{"remove instance i1", "remove instance i2"}))
+		gomega.Expect(report.Steps).To(gomega.HaveLen(1))
+		gomega.Expect(report.Steps[0].Removed).To(gomega.Equal(1))
+		gomega.Expect(report.Steps[0].Errors).To(gomega.HaveLen(1))
+		gomega.Expect(report.Steps[0].Errors[0]).To(gomega.HavePrefix("i1: "))
+	})
+
+	ginkgo.It("should record the clusters whose nodes cannot be removed", func() {
+		system.fail("list nodes c2", codes.Unavailable)
+		report, err := manager.RemoveOrganization(context.Background(), organizationID)
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unavailable))
+		gomega.Expect(report.Steps).To(gomega.HaveLen(3))
+		nodes := report.Steps[2]
+		gomega.Expect(nodes.Name).To(gomega.Equal("nodes"))
+		gomega.Expect(nodes.Removed).To(gomega.Equal(2))
+		gomega.Expect(nodes.Errors).To(gomega.HaveLen(1))
+		gomega.Expect(nodes.Errors[0]).To(gomega.HavePrefix("c2: "))
+		gomega.Expect(system.recorded("remove cluster")).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should stop if the elements of a step cannot be listed", func() {
+		system.fail("list users", codes.Unavailable)
+		report, err := manager.RemoveOrganization(context.Background(), organizationID)
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unavailable))
+		gomega.Expect(report.Steps).To(gomega.HaveLen(5))
+		gomega.Expect(report.Steps[4].Errors).To(gomega.ConsistOf(gomega.HavePrefix("cannot list users: ")))
+		gomega.Expect(system.recorded("remove role")).To(gomega.BeEmpty())
+		gomega.Expect(system.recorded("remove organization")).To(gomega.BeEmpty())
+	})
+})
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-authx-go"
+	"gopkg.in/yaml.v2"
+)
+
+// OwnerRoleName is the name of the role assigned to the owner of the organization by default.
+const OwnerRoleName = "Owner"
+
+// NalejAdminRoleName is the name of the role assigned to the Nalej administrator of the organization by default.
+const NalejAdminRoleName = "NalejAdmin"
+
+// RoleDefinition contains a role that can be created on new organizations.
+type RoleDefinition struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	// Internal is true for the roles managed by applications, with no human involved.
+	Internal bool `json:"internal" yaml:"internal"`
+	// Primitives contains the names of the grpc_authx_go.AccessPrimitive granted by the role.
+	Primitives []string `json:"primitives" yaml:"primitives"`
+}
+
+// AccessPrimitives returns the access primitives granted by the role. The role must have been validated.
+func (rd *RoleDefinition) AccessPrimitives() []grpc_authx_go.AccessPrimitive {
+	primitives := make([]grpc_authx_go.AccessPrimitive, 0, len(rd.Primitives))
+	for _, name := range rd.Primitives {
+		primitives = append(primitives, grpc_authx_go.AccessPrimitive(grpc_authx_go.AccessPrimitive_value[name]))
+	}
+	return primitives
+}
+
+// RoleCatalog contains the roles that can be created on new organizations, in creation order.
+type RoleCatalog struct {
+	Roles []RoleDefinition `json:"roles" yaml:"roles"`
+}
+
+// DefaultRoleCatalog contains the roles used if no catalog file is provided.
+var DefaultRoleCatalog = RoleCatalog{
+	Roles: []RoleDefinition{
+		{
+			Name:        OwnerRoleName,
+			Description: "Owner of the organization",
+			Primitives:  []string{grpc_authx_go.AccessPrimitive_ORG.String()},
+		},
+		{
+			Name:        "Operator",
+			Description: "Manages the resources of the organization",
+			Primitives:  []string{grpc_authx_go.AccessPrimitive_PROFILE.String(), grpc_authx_go.AccessPrimitive_RESOURCES.String()},
+		},
+		{
+			Name:        "Developer",
+			Description: "Manages the applications of the organization",
+			Primitives:  []string{grpc_authx_go.AccessPrimitive_PROFILE.String(), grpc_authx_go.AccessPrimitive_APPS.String()},
+		},
+		{
+			Name:        "AppCluster",
+			Description: "Used by the application clusters to operate on the organization",
+			Internal:    true,
+			Primitives:  []string{grpc_authx_go.AccessPrimitive_APPCLUSTEROPS.String()},
+		},
+		{
+			Name:        NalejAdminRoleName,
+			Description: "Nalej administrator of the organization",
+			Primitives: []string{grpc_authx_go.AccessPrimitive_ORG.String(), grpc_authx_go.AccessPrimitive_ORG_MNGT.String(),
+				grpc_authx_go.AccessPrimitive_RESOURCES_MNGT.String()},
+		},
+	},
+}
+
+// LoadRoleCatalog reads and validates a role catalog. Files with the .json extension are parsed as JSON, and any
+// other file as YAML.
+func LoadRoleCatalog(path string) (*RoleCatalog, derrors.Error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read role catalog")
+	}
+	catalog := &RoleCatalog{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(raw, catalog)
+	} else {
+		err = yaml.UnmarshalStrict(raw, catalog)
+	}
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot parse role catalog")
+	}
+	if vErr := catalog.Validate(); vErr != nil {
+		return nil, vErr
+	}
+	return catalog, nil
+}
+
+// Validate checks that the roles have unique names and known primitives. The roles assigned to the users are
+// validated with the signup templates.
+func (rc *RoleCatalog) Validate() derrors.Error {
+	names := make(map[string]bool, len(rc.Roles))
+	for _, role := range rc.Roles {
+		if role.Name == "" {
+			return derrors.NewInvalidArgumentError("role name must be provided")
+		}
+		if names[role.Name] {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("role %s is defined more than once", role.Name))
+		}
+		names[role.Name] = true
+		if len(role.Primitives) == 0 {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("role %s must grant at least one primitive", role.Name))
+		}
+		for _, primitive := range role.Primitives {
+			if _, known := grpc_authx_go.AccessPrimitive_value[primitive]; !known {
+				return derrors.NewInvalidArgumentError(fmt.Sprintf("role %s contains unknown primitive %s", role.Name, primitive))
+			}
+		}
+	}
+	return nil
+}
+
+// Role returns the definition of the role with the given name.
+func (rc *RoleCatalog) Role(name string) (*RoleDefinition, bool) {
+	for i := range rc.Roles {
+		if rc.Roles[i].Name == name {
+			return &rc.Roles[i], true
+		}
+	}
+	return nil, false
+}
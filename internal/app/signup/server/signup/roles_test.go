@@ -0,0 +1,133 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/grpc-authx-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Role catalog", func() {
+
+	var catalog *RoleCatalog
+
+	ginkgo.BeforeEach(func() {
+		catalog = &RoleCatalog{Roles: []RoleDefinition{
+			{Name: OwnerRoleName, Primitives: []string{"ORG"}},
+			{Name: "Auditor", Primitives: []string{"PROFILE", "RESOURCES"}},
+		}}
+	})
+
+	ginkgo.It("should accept the default catalog", func() {
+		gomega.Expect(DefaultRoleCatalog.Validate()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should return the roles and their access primitives", func() {
+		gomega.Expect(catalog.Validate()).To(gomega.Succeed())
+		role, found := catalog.Role("Auditor")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(role.AccessPrimitives()).To(gomega.Equal([]grpc_authx_go.AccessPrimitive{
+			grpc_authx_go.AccessPrimitive_PROFILE, grpc_authx_go.AccessPrimitive_RESOURCES,
+		}))
+		_, found = catalog.Role("Developer")
+		gomega.Expect(found).To(gomega.BeFalse())
+	})
+
+	table.DescribeTable("should reject invalid catalogs",
+		func(modify func(catalog *RoleCatalog)) {
+			modify(catalog)
+			gomega.Expect(catalog.Validate()).NotTo(gomega.Succeed())
+		},
+		table.Entry("without role name", func(catalog *RoleCatalog) {
+			catalog.Roles[1].Name = ""
+		}),
+		table.Entry("with duplicated roles", func(catalog *RoleCatalog) {
+			catalog.Roles[1].Name = OwnerRoleName
+		}),
+		table.Entry("without primitives", func(catalog *RoleCatalog) {
+			catalog.Roles[1].Primitives = nil
+		}),
+		table.Entry("with unknown primitives", func(catalog *RoleCatalog) {
+			catalog.Roles[1].Primitives = append(catalog.Roles[1].Primitives, "AUDIT")
+		}),
+	)
+
+	ginkgo.Context("loading the catalog", func() {
+		var dir string
+
+		// write creates a catalog file with the given name and content.
+		write := func(name string, content string) string {
+			path := filepath.Join(dir, name)
+			gomega.Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(gomega.Succeed())
+			return path
+		}
+
+		ginkgo.BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "role-catalog")
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+
+		ginkgo.AfterEach(func() {
+			gomega.Expect(os.RemoveAll(dir)).To(gomega.Succeed())
+		})
+
+		table.DescribeTable("should load and validate the catalog",
+			func(name string, content string) {
+				loaded, err := LoadRoleCatalog(write(name, content))
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(loaded.Roles).To(gomega.Equal([]RoleDefinition{
+					{Name: OwnerRoleName, Description: "Owner", Primitives: []string{"ORG"}},
+					{Name: "AppCluster", Internal: true, Primitives: []string{"APPCLUSTEROPS"}},
+				}))
+			},
+			table.Entry("from YAML", "roles.yaml", `
+roles:
+  - {name: Owner, description: Owner, primitives: [ORG]}
+  - {name: AppCluster, internal: true, primitives: [APPCLUSTEROPS]}
+`),
+			table.Entry("from JSON", "roles.JSON", `{"roles": [
+  {"name": "Owner", "description": "Owner", "primitives": ["ORG"]},
+  {"name": "AppCluster", "internal": true, "primitives": ["APPCLUSTEROPS"]}
+]}`),
+		)
+
+		table.DescribeTable("should reject invalid files",
+			func(name string, content string) {
+				_, err := LoadRoleCatalog(write(name, content))
+				gomega.Expect(err).NotTo(gomega.Succeed())
+			},
+			table.Entry("with unknown YAML fields", "roles.yaml", `
+roles:
+  - {name: Owner, primitives: [ORG], permissions: [ORG]}
+`),
+			table.Entry("with malformed YAML", "roles.yml", `roles: [{name: Owner, primitives: [ORG]`),
+			table.Entry("with invalid roles", "roles.json", `{"roles": [{"name": "Owner", "primitives": ["AUDIT"]}]}`),
+		)
+
+		ginkgo.It("should fail if the file does not exist", func() {
+			_, err := LoadRoleCatalog(filepath.Join(dir, "missing.yaml"))
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+})
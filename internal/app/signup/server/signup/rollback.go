@@ -0,0 +1,97 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/nalej/signup/internal/app/signup/server/metrics"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/status"
+)
+
+// compensation contains the action that reverts a signup step that has been successfully applied.
+type compensation struct {
+	description string
+	undo        func(ctx context.Context) error
+}
+
+// signupRollback records the steps applied during a signup so they can be reverted if a later step fails.
+type signupRollback struct {
+	// ctx is the context of the signup request.
+	ctx            context.Context
+	organizationID string
+	compensations  []compensation
+}
+
+// newSignupRollback creates an empty rollback for the given organization.
+func newSignupRollback(ctx context.Context, organizationID string) *signupRollback {
+	return &signupRollback{
+		ctx:            ctx,
+		organizationID: organizationID,
+		compensations:  make([]compensation, 0),
+	}
+}
+
+// Add records the compensation of a step that has been applied.
+func (r *signupRollback) Add(description string, undo func(ctx context.Context) error) {
+	r.compensations = append(r.compensations, compensation{description, undo})
+}
+
+// Execute runs the recorded compensations in reverse order. All compensations are attempted even if some of them
+// fail, and the descriptions of the failed ones are returned. The compensations are not cancelled with the signup
+// request, as the signup usually fails because the request has been cancelled or has timed out.
+func (r *signupRollback) Execute() []string {
+	ctx, cancel := detachedContext(r.ctx, DefaultRollbackTimeout)
+	defer cancel()
+	failed := make([]string, 0)
+	for i := len(r.compensations) - 1; i >= 0; i-- {
+		c := r.compensations[i]
+		if err := c.undo(ctx); err != nil {
+			log.Error().Str("organizationID", r.organizationID).Str("step", c.description).
+				Str("trace", conversions.ToDerror(err).DebugReport()).Msg("cannot rollback signup step")
+			failed = append(failed, c.description)
+			continue
+		}
+		log.Debug().Str("organizationID", r.organizationID).Str("step", c.description).Msg("signup step rolled back")
+	}
+	return failed
+}
+
+// Fail rolls back the signup after a step failed. The returned error keeps the code of the cause, mapping
+// derrors.Error causes as the rest of the service does, and reports the outcome of the rollback.
+func (r *signupRollback) Fail(cause error, msg string) error {
+	failed := r.Execute()
+	metrics.ObserveRollback(len(failed) == 0)
+	var outcome string
+	if len(failed) == 0 {
+		outcome = fmt.Sprintf("rollback completed, %d steps reverted", len(r.compensations))
+		log.Warn().Str("organizationID", r.organizationID).Int("steps", len(r.compensations)).Msg("signup rolled back")
+	} else {
+		outcome = fmt.Sprintf("rollback incomplete, manual cleanup required for: %s", strings.Join(failed, ", "))
+		log.Error().Str("organizationID", r.organizationID).Strs("failed", failed).Msg("signup rollback incomplete")
+	}
+	if dErr, ok := cause.(derrors.Error); ok {
+		cause = conversions.ToGRPCError(dErr)
+	}
+	st := status.Convert(cause)
+	return status.Errorf(st.Code(), "%s: %s; %s", msg, st.Message(), outcome)
+}
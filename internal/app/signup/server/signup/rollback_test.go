@@ -0,0 +1,102 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nalej/derrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = ginkgo.Describe("Signup rollback", func() {
+
+	var executed []string
+	var rollback *signupRollback
+
+	// step records a compensation that appends its description to the executed ones and returns the given error.
+	step := func(description string, err error) {
+		rollback.Add(description, func(ctx context.Context) error {
+			executed = append(executed, description)
+			return err
+		})
+	}
+
+	ginkgo.BeforeEach(func() {
+		executed = make([]string, 0)
+		rollback = newSignupRollback(context.Background(), "org-1")
+	})
+
+	ginkgo.It("should revert the steps in reverse order", func() {
+		step("organization", nil)
+		step("setting", nil)
+		step("role Owner", nil)
+		gomega.Expect(rollback.Execute()).To(gomega.BeEmpty())
+		gomega.Expect(executed).To(gomega.Equal([]string{"role Owner", "setting", "organization"}))
+	})
+
+	ginkgo.It("should attempt every step and return the failed ones", func() {
+		step("organization", nil)
+		step("setting", errors.New("unavailable"))
+		step("role Owner", status.Error(codes.Unavailable, "unavailable"))
+		step("owner", nil)
+		gomega.Expect(rollback.Execute()).To(gomega.Equal([]string{"role Owner", "setting"}))
+		gomega.Expect(executed).To(gomega.HaveLen(4))
+	})
+
+	ginkgo.It("should not be cancelled with the signup request", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		rollback = newSignupRollback(ctx, "org-1")
+		rollback.Add("organization", func(ctx context.Context) error {
+			return ctx.Err()
+		})
+		gomega.Expect(rollback.Execute()).To(gomega.BeEmpty())
+	})
+
+	ginkgo.Context("failing a signup", func() {
+		ginkgo.It("should keep the code of a gRPC cause and report the rollback", func() {
+			step("organization", nil)
+			err := rollback.Fail(status.Error(codes.AlreadyExists, "role exists"), "cannot create roles")
+			gomega.Expect(status.Code(err)).To(gomega.Equal(codes.AlreadyExists))
+			gomega.Expect(status.Convert(err).Message()).To(gomega.And(
+				gomega.HavePrefix("cannot create roles: role exists"),
+				gomega.HaveSuffix("rollback completed, 1 steps reverted")))
+		})
+
+		ginkgo.It("should map the code of a derrors cause", func() {
+			step("organization", nil)
+			err := rollback.Fail(derrors.NewInternalError("role has not been created"), "cannot create owner")
+			gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Internal))
+			err = rollback.Fail(derrors.NewNotFoundError("role not found"), "cannot create owner")
+			gomega.Expect(status.Code(err)).To(gomega.Equal(codes.NotFound))
+		})
+
+		ginkgo.It("should report the steps that require manual cleanup", func() {
+			step("organization", errors.New("unavailable"))
+			step("setting", nil)
+			err := rollback.Fail(status.Error(codes.Unavailable, "timeout"), "cannot create owner")
+			gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unavailable))
+			gomega.Expect(status.Convert(err).Message()).To(gomega.HaveSuffix(
+				"rollback incomplete, manual cleanup required for: organization"))
+		})
+	})
+})
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"context"
+	"time"
+
+	"github.com/nalej/grpc-organization-go"
+	"github.com/nalej/grpc-organization-manager-go"
+	"github.com/nalej/grpc-signup-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// blockingOrgClient blocks the creation of organizations until it is released, and then fails it.
+type blockingOrgClient struct {
+	grpc_organization_manager_go.OrganizationsClient
+	started chan struct{}
+	release chan struct{}
+}
+
+func (boc *blockingOrgClient) AddOrganization(ctx context.Context, in *grpc_organization_go.AddOrganizationRequest, opts ...grpc.CallOption) (*grpc_organization_manager_go.Organization, error) {
+	boc.started <- struct{}{}
+	<-boc.release
+	return nil, status.Error(codes.Unavailable, "organization manager is not available")
+}
+
+var _ = ginkgo.Describe("Shutdown of the signups", func() {
+
+	var orgClient *blockingOrgClient
+	var manager Manager
+	var cancels []context.CancelFunc
+	request := &grpc_signup_go.SignupOrganizationRequest{OrganizationName: "acme"}
+
+	// timeout returns a context that expires after the given time.
+	timeout := func(duration time.Duration) context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), duration)
+		cancels = append(cancels, cancel)
+		return ctx
+	}
+
+	ginkgo.BeforeEach(func() {
+		orgClient = &blockingOrgClient{started: make(chan struct{}, 1), release: make(chan struct{})}
+		manager = NewManager(orgClient, nil, nil, nil, nil, &DefaultRoleCatalog, &DefaultTemplateCatalog, Timeouts{}, 1, nil)
+		cancels = make([]context.CancelFunc, 0)
+	})
+
+	ginkgo.AfterEach(func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	})
+
+	ginkgo.It("should wait for the in-flight signups", func() {
+		finished := make(chan error)
+		go func() {
+			_, err := manager.SignupOrganization(context.Background(), request)
+			finished <- err
+		}()
+		<-orgClient.started
+		gomega.Expect(manager.Drain(timeout(20 * time.Millisecond))).To(gomega.BeFalse())
+		close(orgClient.release)
+		gomega.Expect(manager.Drain(timeout(time.Second))).To(gomega.BeTrue())
+		gomega.Expect(status.Code(<-finished)).To(gomega.Equal(codes.Unavailable))
+	})
+
+	ginkgo.It("should reject new signups once draining has started", func() {
+		gomega.Expect(manager.Drain(timeout(time.Second))).To(gomega.BeTrue())
+		_, err := manager.SignupOrganization(context.Background(), request)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+		gomega.Expect(orgClient.started).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should wait for the running jobs and cancel the pending ones", func() {
+		jobs := NewJobManager(&manager, 1, 10, time.Hour)
+		jobs.Start()
+		running, err := jobs.Submit(context.Background(), request)
+		gomega.Expect(err).To(gomega.Succeed())
+		<-orgClient.started
+		pending, err := jobs.Submit(context.Background(), request)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		gomega.Expect(jobs.Stop(timeout(20 * time.Millisecond))).To(gomega.BeFalse())
+		job, err := jobs.Get(pending.JobId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(job.Status).To(gomega.Equal(grpc_signup_go.SignupJobStatus_FAILED))
+		_, err = jobs.Submit(context.Background(), request)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+
+		close(orgClient.release)
+		gomega.Expect(jobs.Stop(timeout(time.Second))).To(gomega.BeTrue())
+		job, err = jobs.Get(running.JobId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(job.Status).To(gomega.Equal(grpc_signup_go.SignupJobStatus_FAILED))
+		gomega.Expect(job.Steps).To(gomega.HaveLen(1))
+		gomega.Expect(manager.Drain(timeout(time.Second))).To(gomega.BeTrue())
+	})
+})
@@ -0,0 +1,231 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-organization-go"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultTemplateName is the name of the template used when the signup request does not select one.
+const DefaultTemplateName = "default"
+
+// OwnerUser identifies the owner of the organization in the users of a template.
+const OwnerUser = "owner"
+
+// NalejAdminUser identifies the Nalej administrator of the organization in the users of a template.
+const NalejAdminUser = "nalejadmin"
+
+// SettingPolicyRequired fails the signup if the setting cannot be created.
+const SettingPolicyRequired = "required"
+
+// SettingPolicyBestEffort continues the signup if the setting cannot be created.
+const SettingPolicyBestEffort = "best-effort"
+
+// TemplateSetting contains a setting created on the organizations of a template.
+type TemplateSetting struct {
+	// Key with the name of the grpc_organization_go.AllowedSettingKey.
+	Key         string `json:"key" yaml:"key"`
+	Value       string `json:"value" yaml:"value"`
+	Description string `json:"description" yaml:"description"`
+	// Policy is either required or best-effort. Settings are required by default.
+	Policy string `json:"policy" yaml:"policy"`
+}
+
+// Required checks if the signup must fail when the setting cannot be created.
+func (ts *TemplateSetting) Required() bool {
+	return ts.Policy != SettingPolicyBestEffort
+}
+
+// TemplateUser assigns a role to one of the users created on signup.
+type TemplateUser struct {
+	// User is either owner or nalejadmin.
+	User string `json:"user" yaml:"user"`
+	Role string `json:"role" yaml:"role"`
+}
+
+// SignupTemplate contains the roles and settings created on the organizations of a given tier, and the roles of
+// the users created on signup.
+type SignupTemplate struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	// Roles contains the names of the roles of the catalog created on the organization. All the roles of the
+	// catalog are created if empty.
+	Roles    []string          `json:"roles" yaml:"roles"`
+	Settings []TemplateSetting `json:"settings" yaml:"settings"`
+	Users    []TemplateUser    `json:"users" yaml:"users"`
+}
+
+// UserRole returns the role assigned to a user of the signup.
+func (st *SignupTemplate) UserRole(user string) string {
+	for _, templateUser := range st.Users {
+		if templateUser.User == user {
+			return templateUser.Role
+		}
+	}
+	return ""
+}
+
+// hasRole checks if a role of the catalog is created by the template.
+func (st *SignupTemplate) hasRole(name string) bool {
+	if len(st.Roles) == 0 {
+		return true
+	}
+	for _, role := range st.Roles {
+		if role == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the template against the role catalog.
+func (st *SignupTemplate) validate(roles *RoleCatalog) derrors.Error {
+	if st.Name == "" {
+		return derrors.NewInvalidArgumentError("template name must be provided")
+	}
+	for _, name := range st.Roles {
+		if _, found := roles.Role(name); !found {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("template %s contains unknown role %s", st.Name, name))
+		}
+	}
+	keys := make(map[string]bool, len(st.Settings))
+	for _, setting := range st.Settings {
+		if _, known := grpc_organization_go.AllowedSettingKey_value[setting.Key]; !known {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("template %s contains unknown setting %s", st.Name, setting.Key))
+		}
+		if keys[setting.Key] {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("template %s defines setting %s more than once", st.Name, setting.Key))
+		}
+		if setting.Policy != "" && setting.Policy != SettingPolicyRequired && setting.Policy != SettingPolicyBestEffort {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("template %s contains unknown policy %s for setting %s", st.Name, setting.Policy, setting.Key))
+		}
+		keys[setting.Key] = true
+	}
+	users := make(map[string]bool, len(st.Users))
+	for _, user := range st.Users {
+		if user.User != OwnerUser && user.User != NalejAdminUser {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("template %s contains unknown user %s", st.Name, user.User))
+		}
+		if users[user.User] {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("template %s assigns a role to %s more than once", st.Name, user.User))
+		}
+		users[user.User] = true
+		role, found := roles.Role(user.Role)
+		if !found || !st.hasRole(user.Role) {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("template %s assigns role %s to %s but the role is not created", st.Name, user.Role, user.User))
+		}
+		if role.Internal {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("template %s assigns internal role %s to %s", st.Name, user.Role, user.User))
+		}
+	}
+	for _, required := range []string{OwnerUser, NalejAdminUser} {
+		if !users[required] {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("template %s must assign a role to %s", st.Name, required))
+		}
+	}
+	return nil
+}
+
+// TemplateCatalog contains the signup templates that can be selected on signup.
+type TemplateCatalog struct {
+	Templates []SignupTemplate `json:"templates" yaml:"templates"`
+}
+
+// DefaultTemplateCatalog contains the template used if no template file is provided.
+var DefaultTemplateCatalog = TemplateCatalog{
+	Templates: []SignupTemplate{
+		{
+			Name:        DefaultTemplateName,
+			Description: "Default organization",
+			Settings: []TemplateSetting{
+				{
+					Key:         grpc_organization_go.AllowedSettingKey_DEFAULT_STORAGE_SIZE.String(),
+					Value:       fmt.Sprintf("%d", 100*1024*1024),
+					Description: "Default Storage Size (bytes)",
+					Policy:      SettingPolicyRequired,
+				},
+			},
+			Users: []TemplateUser{
+				{User: NalejAdminUser, Role: NalejAdminRoleName},
+				{User: OwnerUser, Role: OwnerRoleName},
+			},
+		},
+	},
+}
+
+// LoadTemplateCatalog reads a template catalog and validates it against the role catalog. Files with the .json
+// extension are parsed as JSON, and any other file as YAML.
+func LoadTemplateCatalog(path string, roles *RoleCatalog) (*TemplateCatalog, derrors.Error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read template catalog")
+	}
+	catalog := &TemplateCatalog{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(raw, catalog)
+	} else {
+		err = yaml.UnmarshalStrict(raw, catalog)
+	}
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot parse template catalog")
+	}
+	if vErr := catalog.Validate(roles); vErr != nil {
+		return nil, vErr
+	}
+	return catalog, nil
+}
+
+// Validate checks that the templates have unique names, that the default template exists, and that every
+// template is consistent with the role catalog.
+func (tc *TemplateCatalog) Validate(roles *RoleCatalog) derrors.Error {
+	names := make(map[string]bool, len(tc.Templates))
+	for i := range tc.Templates {
+		template := &tc.Templates[i]
+		if names[template.Name] {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("template %s is defined more than once", template.Name))
+		}
+		names[template.Name] = true
+		if err := template.validate(roles); err != nil {
+			return err
+		}
+	}
+	if !names[DefaultTemplateName] {
+		return derrors.NewInvalidArgumentError(fmt.Sprintf("template %s must be defined", DefaultTemplateName))
+	}
+	return nil
+}
+
+// Template returns the template with the given name, or the default one if the name is empty.
+func (tc *TemplateCatalog) Template(name string) (*SignupTemplate, derrors.Error) {
+	if name == "" {
+		name = DefaultTemplateName
+	}
+	for i := range tc.Templates {
+		if tc.Templates[i].Name == name {
+			return &tc.Templates[i], nil
+		}
+	}
+	return nil, derrors.NewInvalidArgumentError("unknown signup plan").WithParams(name)
+}
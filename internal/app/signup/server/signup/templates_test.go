@@ -0,0 +1,167 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package signup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	"github.com/onsi/gomega"
+)
+
+// validTemplate returns a template consistent with the default role catalog.
+func validTemplate(name string) SignupTemplate {
+	return SignupTemplate{
+		Name:  name,
+		Roles: []string{OwnerRoleName, "AppCluster", NalejAdminRoleName},
+		Settings: []TemplateSetting{
+			{Key: "DEFAULT_STORAGE_SIZE", Value: "1024", Policy: SettingPolicyBestEffort},
+		},
+		Users: []TemplateUser{
+			{User: NalejAdminUser, Role: NalejAdminRoleName},
+			{User: OwnerUser, Role: OwnerRoleName},
+		},
+	}
+}
+
+var _ = ginkgo.Describe("Template catalog", func() {
+
+	var catalog *TemplateCatalog
+
+	ginkgo.BeforeEach(func() {
+		catalog = &TemplateCatalog{Templates: []SignupTemplate{validTemplate(DefaultTemplateName), validTemplate("trial")}}
+	})
+
+	ginkgo.It("should accept the default catalog", func() {
+		gomega.Expect(DefaultTemplateCatalog.Validate(&DefaultRoleCatalog)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should accept a consistent catalog", func() {
+		gomega.Expect(catalog.Validate(&DefaultRoleCatalog)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should return the default template if none is selected", func() {
+		template, err := catalog.Template("")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(template.Name).To(gomega.Equal(DefaultTemplateName))
+		template, err = catalog.Template("trial")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(template.Name).To(gomega.Equal("trial"))
+		_, err = catalog.Template("enterprise")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should consider settings required unless they are best-effort", func() {
+		gomega.Expect((&TemplateSetting{}).Required()).To(gomega.BeTrue())
+		gomega.Expect((&TemplateSetting{Policy: SettingPolicyRequired}).Required()).To(gomega.BeTrue())
+		gomega.Expect((&TemplateSetting{Policy: SettingPolicyBestEffort}).Required()).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should create every role of the catalog if the template does not list them", func() {
+		template := validTemplate("all")
+		template.Roles = nil
+		gomega.Expect(template.hasRole("Developer")).To(gomega.BeTrue())
+		some := validTemplate("some")
+		gomega.Expect(some.hasRole("Developer")).To(gomega.BeFalse())
+	})
+
+	table.DescribeTable("should reject inconsistent catalogs",
+		func(modify func(catalog *TemplateCatalog)) {
+			modify(catalog)
+			gomega.Expect(catalog.Validate(&DefaultRoleCatalog)).NotTo(gomega.Succeed())
+		},
+		table.Entry("without default template", func(catalog *TemplateCatalog) {
+			catalog.Templates = catalog.Templates[1:]
+		}),
+		table.Entry("with duplicated templates", func(catalog *TemplateCatalog) {
+			catalog.Templates[1].Name = DefaultTemplateName
+		}),
+		table.Entry("without template name", func(catalog *TemplateCatalog) {
+			catalog.Templates[1].Name = ""
+		}),
+		table.Entry("with unknown roles", func(catalog *TemplateCatalog) {
+			catalog.Templates[1].Roles = append(catalog.Templates[1].Roles, "Auditor")
+		}),
+		table.Entry("with unknown settings", func(catalog *TemplateCatalog) {
+			catalog.Templates[1].Settings[0].Key = "UNKNOWN_SETTING"
+		}),
+		table.Entry("with duplicated settings", func(catalog *TemplateCatalog) {
+			catalog.Templates[1].Settings = append(catalog.Templates[1].Settings, catalog.Templates[1].Settings[0])
+		}),
+		table.Entry("with unknown setting policies", func(catalog *TemplateCatalog) {
+			catalog.Templates[1].Settings[0].Policy = "optional"
+		}),
+		table.Entry("with unknown users", func(catalog *TemplateCatalog) {
+			catalog.Templates[1].Users = append(catalog.Templates[1].Users, TemplateUser{User: "guest", Role: OwnerRoleName})
+		}),
+		table.Entry("assigning a role twice to a user", func(catalog *TemplateCatalog) {
+			catalog.Templates[1].Users = append(catalog.Templates[1].Users, TemplateUser{User: OwnerUser, Role: OwnerRoleName})
+		}),
+		table.Entry("assigning a role not created by the template", func(catalog *TemplateCatalog) {
+			catalog.Templates[1].Users[1].Role = "Developer"
+		}),
+		table.Entry("assigning an internal role", func(catalog *TemplateCatalog) {
+			catalog.Templates[1].Users[1].Role = "AppCluster"
+		}),
+		table.Entry("without owner", func(catalog *TemplateCatalog) {
+			catalog.Templates[1].Users = catalog.Templates[1].Users[:1]
+		}),
+	)
+
+	ginkgo.Context("loading the catalog", func() {
+		var dir string
+
+		ginkgo.BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "template-catalog")
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+
+		ginkgo.AfterEach(func() {
+			gomega.Expect(os.RemoveAll(dir)).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should load and validate a YAML file", func() {
+			path := filepath.Join(dir, "templates.yaml")
+			content := `
+templates:
+  - name: default
+    settings:
+      - {key: DEFAULT_STORAGE_SIZE, value: "1024", policy: best-effort}
+    users:
+      - {user: nalejadmin, role: NalejAdmin}
+      - {user: owner, role: Owner}
+`
+			gomega.Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(gomega.Succeed())
+			loaded, err := LoadTemplateCatalog(path, &DefaultRoleCatalog)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(loaded.Templates).To(gomega.HaveLen(1))
+			gomega.Expect(loaded.Templates[0].Settings[0].Required()).To(gomega.BeFalse())
+			gomega.Expect(loaded.Templates[0].UserRole(OwnerUser)).To(gomega.Equal(OwnerRoleName))
+		})
+
+		ginkgo.It("should reject invalid catalogs", func() {
+			path := filepath.Join(dir, "templates.json")
+			gomega.Expect(ioutil.WriteFile(path, []byte(`{"templates": [{"name": "trial"}]}`), 0600)).To(gomega.Succeed())
+			_, err := LoadTemplateCatalog(path, &DefaultRoleCatalog)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+})
@@ -0,0 +1,179 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nalej/derrors"
+)
+
+// minPersonalInfoLength is the minimum length of the parts of the email and name of a user that cannot be included
+// in its password. Shorter parts are ignored to avoid rejecting passwords by chance.
+const minPersonalInfoLength = 3
+
+// PasswordPolicy contains the requirements of the passwords of the owner and the Nalej administrator.
+type PasswordPolicy struct {
+	// MinLength with the minimum number of characters of a password.
+	MinLength int
+	// MaxLength with the maximum number of characters of a password.
+	MaxLength int
+	// RequireUppercase requires at least one uppercase letter.
+	RequireUppercase bool
+	// RequireLowercase requires at least one lowercase letter.
+	RequireLowercase bool
+	// RequireDigit requires at least one digit.
+	RequireDigit bool
+	// RequireSymbol requires at least one character that is not a letter, a digit or a space.
+	RequireSymbol bool
+	// DisallowPersonalInfo rejects passwords that contain the email or the name of the user.
+	DisallowPersonalInfo bool
+	// DenyListPath with the path of a file with the rejected passwords, one per line. Empty lines and lines starting
+	// with # are ignored.
+	DenyListPath string
+
+	denied map[string]bool
+}
+
+// DefaultPasswordPolicy returns the policy used if no other policy is configured.
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:            8,
+		MaxLength:            128,
+		RequireUppercase:     true,
+		RequireLowercase:     true,
+		RequireDigit:         true,
+		RequireSymbol:        false,
+		DisallowPersonalInfo: true,
+	}
+}
+
+// Validate checks the limits of the policy.
+func (pp *PasswordPolicy) Validate() derrors.Error {
+	if pp.MinLength <= 0 {
+		return derrors.NewInvalidArgumentError("passwordMinLength must be positive")
+	}
+	if pp.MaxLength < pp.MinLength {
+		return derrors.NewInvalidArgumentError("passwordMaxLength cannot be lower than passwordMinLength")
+	}
+	return nil
+}
+
+// LoadDenyList validates the policy and reads the rejected passwords from the deny list file, if set. Passwords are
+// compared ignoring case.
+func (pp *PasswordPolicy) LoadDenyList() derrors.Error {
+	if err := pp.Validate(); err != nil {
+		return err
+	}
+	pp.denied = make(map[string]bool, 0)
+	if pp.DenyListPath == "" {
+		return nil
+	}
+	file, err := os.Open(pp.DenyListPath)
+	if err != nil {
+		return derrors.AsError(err, "cannot read password deny list")
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pp.denied[strings.ToLower(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return derrors.AsError(err, "cannot read password deny list")
+	}
+	return nil
+}
+
+// personalInfo returns the parts of the email and names of a user that cannot be included in its password.
+func personalInfo(email string, names ...string) []string {
+	parts := make([]string, 0)
+	candidates := append([]string{email}, names...)
+	if at := strings.LastIndex(email, "@"); at > 0 {
+		candidates = append(candidates, email[:at])
+	}
+	for _, candidate := range candidates {
+		for _, part := range strings.Fields(candidate) {
+			if utf8.RuneCountInString(part) >= minPersonalInfoLength {
+				parts = append(parts, strings.ToLower(part))
+			}
+		}
+	}
+	return parts
+}
+
+// violation checks a password against the policy. It returns a description with every requirement that the password
+// does not meet, or an empty string if the password is valid.
+func (pp *PasswordPolicy) violation(field string, password string, personal []string) string {
+	reasons := make([]string, 0)
+	length := utf8.RuneCountInString(password)
+	if length < pp.MinLength {
+		reasons = append(reasons, fmt.Sprintf("must have at least %d characters", pp.MinLength))
+	}
+	if length > pp.MaxLength {
+		reasons = append(reasons, fmt.Sprintf("cannot have more than %d characters", pp.MaxLength))
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r) && !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if pp.RequireUppercase && !upper {
+		reasons = append(reasons, "must contain an uppercase letter")
+	}
+	if pp.RequireLowercase && !lower {
+		reasons = append(reasons, "must contain a lowercase letter")
+	}
+	if pp.RequireDigit && !digit {
+		reasons = append(reasons, "must contain a digit")
+	}
+	if pp.RequireSymbol && !symbol {
+		reasons = append(reasons, "must contain a symbol")
+	}
+	lowered := strings.ToLower(password)
+	if pp.DisallowPersonalInfo {
+		for _, part := range personal {
+			if strings.Contains(lowered, part) {
+				reasons = append(reasons, "cannot contain the email or name of the user")
+				break
+			}
+		}
+	}
+	if pp.denied[lowered] {
+		reasons = append(reasons, "is a common password")
+	}
+	if len(reasons) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s %s", field, strings.Join(reasons, ", "))
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Password policy", func() {
+
+	var policy *PasswordPolicy
+
+	ginkgo.BeforeEach(func() {
+		policy = DefaultPasswordPolicy()
+		gomega.Expect(policy.LoadDenyList()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should accept a password that meets every requirement", func() {
+		gomega.Expect(policy.violation("owner_password", "S3cret-Passw0rd", nil)).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should list every requirement that is not met", func() {
+		gomega.Expect(policy.violation("owner_password", "abc", nil)).To(gomega.Equal(
+			"owner_password must have at least 8 characters, must contain an uppercase letter, must contain a digit"))
+	})
+
+	ginkgo.It("should check the maximum length in characters", func() {
+		policy.MaxLength = 10
+		gomega.Expect(policy.violation("owner_password", "Aa1ñññññññ", nil)).To(gomega.BeEmpty())
+		gomega.Expect(policy.violation("owner_password", "Aa1ññññññññ", nil)).To(gomega.Equal(
+			"owner_password cannot have more than 10 characters"))
+	})
+
+	ginkgo.It("should require a symbol if configured", func() {
+		policy.RequireSymbol = true
+		gomega.Expect(policy.violation("owner_password", "Secret1Password", nil)).To(gomega.Equal(
+			"owner_password must contain a symbol"))
+		gomega.Expect(policy.violation("owner_password", "Secret1Password!", nil)).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should not require the disabled character classes", func() {
+		policy.RequireUppercase = false
+		policy.RequireLowercase = false
+		policy.RequireDigit = false
+		gomega.Expect(policy.violation("owner_password", "--------", nil)).To(gomega.BeEmpty())
+	})
+
+	ginkgo.Context("personal information", func() {
+		var personal []string
+
+		ginkgo.BeforeEach(func() {
+			personal = personalInfo("jane.roe@acme.com", "Jane", "Van Roe")
+		})
+
+		ginkgo.It("should reject the email, its local part and the names ignoring case", func() {
+			for _, password := range []string{"Jane.Roe@acme.com1", "x-JANE.ROE-1a", "My-Jane-1234", "Van-Der-Roe-1a"} {
+				gomega.Expect(policy.violation("owner_password", password, personal)).To(gomega.Equal(
+					"owner_password cannot contain the email or name of the user"), password)
+			}
+		})
+
+		ginkgo.It("should ignore short parts of the names", func() {
+			short := personalInfo("a@b.com", "Va")
+			gomega.Expect(short).NotTo(gomega.ContainElement("va"))
+			gomega.Expect(policy.violation("owner_password", "Va-Secret-123", short)).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should accept personal information if it is allowed", func() {
+			policy.DisallowPersonalInfo = false
+			gomega.Expect(policy.violation("owner_password", "My-Jane-1234", personal)).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("deny list", func() {
+		var dir string
+
+		ginkgo.BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "password-deny-list")
+			gomega.Expect(err).To(gomega.Succeed())
+			policy.DenyListPath = filepath.Join(dir, "passwords.txt")
+			content := strings.Join([]string{"# common passwords", "", "  Welcome123  ", "Passw0rd"}, "\n")
+			gomega.Expect(ioutil.WriteFile(policy.DenyListPath, []byte(content), 0600)).To(gomega.Succeed())
+			gomega.Expect(policy.LoadDenyList()).To(gomega.Succeed())
+		})
+
+		ginkgo.AfterEach(func() {
+			gomega.Expect(os.RemoveAll(dir)).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject the listed passwords ignoring case", func() {
+			gomega.Expect(policy.violation("owner_password", "WELCOME123a", nil)).To(gomega.BeEmpty())
+			gomega.Expect(policy.violation("owner_password", "wELCOME123", nil)).To(gomega.Equal(
+				"owner_password is a common password"))
+		})
+
+		ginkgo.It("should skip comments and empty lines", func() {
+			gomega.Expect(policy.denied).To(gomega.HaveLen(2))
+		})
+
+		ginkgo.It("should fail if the file cannot be read", func() {
+			policy.DenyListPath = filepath.Join(dir, "missing.txt")
+			gomega.Expect(policy.LoadDenyList()).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.It("should reject invalid limits", func() {
+		policy.MinLength = 0
+		gomega.Expect(policy.Validate()).NotTo(gomega.Succeed())
+		policy.MinLength = 10
+		policy.MaxLength = 9
+		gomega.Expect(policy.Validate()).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should be applied to the passwords of a signup request", func() {
+		rules := defaultRules()
+		request := validSignupRequest()
+		request.OwnerPassword = "Jane-12345"
+		request.NalejadminPassword = "short"
+		violations := validationViolations(request, rules)
+		gomega.Expect(violations).To(gomega.HaveLen(2))
+		gomega.Expect(violations["owner_password"]).To(gomega.Equal("owner_password cannot contain the email or name of the user"))
+		gomega.Expect(violations["nalejadmin_password"]).To(gomega.HavePrefix("nalejadmin_password must have at least 8 characters"))
+	})
+})
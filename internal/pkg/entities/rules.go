@@ -0,0 +1,197 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultMaxLengths contains the maximum length of each field of a signup request.
+var DefaultMaxLengths = map[string]int{
+	"organization_name":         128,
+	"organization_email":        254,
+	"organization_full_address": 512,
+	"organization_city":         128,
+	"organization_state":        128,
+	"organization_country":      64,
+	"organization_zip_code":     16,
+	"organization_photo_base64": 4 * 1024 * 1024,
+	"owner_email":               254,
+	"owner_name":                128,
+	"owner_last_name":           128,
+	"owner_title":               128,
+	"owner_password":            1024,
+	"nalejadmin_email":          254,
+	"nalejadmin_name":           128,
+	"nalejadmin_last_name":      128,
+	"nalejadmin_title":          128,
+	"nalejadmin_password":       1024,
+}
+
+// DefaultZipCodePatterns contains the format of the ZIP codes of some countries by ISO 3166-1 alpha-2 code. The ZIP
+// codes of other countries are only checked against the maximum length.
+var DefaultZipCodePatterns = map[string]string{
+	"AU": `^\d{4}$`,
+	"BR": `^\d{5}-?\d{3}$`,
+	"CA": `^[A-Za-z]\d[A-Za-z] ?\d[A-Za-z]\d$`,
+	"DE": `^\d{5}$`,
+	"ES": `^\d{5}$`,
+	"FR": `^\d{5}$`,
+	"GB": `^[A-Za-z]{1,2}\d[A-Za-z\d]? ?\d[A-Za-z]{2}$`,
+	"IN": `^\d{6}$`,
+	"IT": `^\d{5}$`,
+	"JP": `^\d{3}-?\d{4}$`,
+	"MX": `^\d{5}$`,
+	"NL": `^\d{4} ?[A-Za-z]{2}$`,
+	"PT": `^\d{4}-\d{3}$`,
+	"US": `^\d{5}(-\d{4})?$`,
+}
+
+// SignupRules contains the rules applied to the fields of a signup request besides being provided.
+type SignupRules struct {
+	// AllowedEmailDomains contains the only domains, and their subdomains, accepted on the emails of the organization
+	// and its owner. Any domain is accepted if empty.
+	AllowedEmailDomains []string `json:"allowedEmailDomains" yaml:"allowedEmailDomains"`
+	// DeniedEmailDomains contains the domains, and their subdomains, rejected on the emails of the organization and
+	// its owner.
+	DeniedEmailDomains []string `json:"deniedEmailDomains" yaml:"deniedEmailDomains"`
+	// ValidateCountry requires the country of the organization to be an ISO 3166-1 alpha-2 code.
+	ValidateCountry bool `json:"validateCountry" yaml:"validateCountry"`
+	// ZipCodePatterns contains the regular expression of the ZIP codes by country code. They are only applied if
+	// the country is validated.
+	ZipCodePatterns map[string]string `json:"zipCodePatterns" yaml:"zipCodePatterns"`
+	// MaxLengths contains the maximum length of the fields. Fields not included keep their default limit.
+	MaxLengths map[string]int `json:"maxLengths" yaml:"maxLengths"`
+	// Password contains the policy applied to the passwords of the owner and the Nalej administrator. It is set from
+	// the configuration of the service instead of the rules file.
+	Password *PasswordPolicy `json:"-" yaml:"-"`
+
+	zipCodes map[string]*regexp.Regexp
+}
+
+// DefaultSignupRules returns the rules used if no rules file is provided.
+func DefaultSignupRules() *SignupRules {
+	rules := &SignupRules{
+		AllowedEmailDomains: make([]string, 0),
+		DeniedEmailDomains:  make([]string, 0),
+		ValidateCountry:     true,
+		ZipCodePatterns:     make(map[string]string, len(DefaultZipCodePatterns)),
+		MaxLengths:          make(map[string]int, 0),
+		Password:            DefaultPasswordPolicy(),
+	}
+	for country, pattern := range DefaultZipCodePatterns {
+		rules.ZipCodePatterns[country] = pattern
+	}
+	return rules
+}
+
+// LoadSignupRules reads and validates a rules file. Files with the .json extension are parsed as JSON, and any other
+// file as YAML. The ZIP code patterns of the file replace the default ones if set.
+func LoadSignupRules(path string) (*SignupRules, derrors.Error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read signup rules")
+	}
+	rules := DefaultSignupRules()
+	rules.ZipCodePatterns = nil
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(raw, rules)
+	} else {
+		err = yaml.UnmarshalStrict(raw, rules)
+	}
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot parse signup rules")
+	}
+	if rules.ZipCodePatterns == nil {
+		rules.ZipCodePatterns = DefaultSignupRules().ZipCodePatterns
+	}
+	if vErr := rules.Validate(); vErr != nil {
+		return nil, vErr
+	}
+	return rules, nil
+}
+
+// Validate checks the rules, compiles the ZIP code patterns and loads the password deny list. It must be called
+// before using the rules.
+func (sr *SignupRules) Validate() derrors.Error {
+	for _, domains := range [][]string{sr.AllowedEmailDomains, sr.DeniedEmailDomains} {
+		for _, domain := range domains {
+			if domain == "" || strings.Contains(domain, "@") {
+				return derrors.NewInvalidArgumentError(fmt.Sprintf("invalid email domain %q", domain))
+			}
+		}
+	}
+	for field, maxLength := range sr.MaxLengths {
+		if _, known := DefaultMaxLengths[field]; !known {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("unknown field %s in max lengths", field))
+		}
+		if maxLength <= 0 {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("max length of %s must be positive", field))
+		}
+	}
+	sr.zipCodes = make(map[string]*regexp.Regexp, len(sr.ZipCodePatterns))
+	for country, pattern := range sr.ZipCodePatterns {
+		if !countryCodes[strings.ToUpper(country)] {
+			return derrors.NewInvalidArgumentError(fmt.Sprintf("unknown country %s in ZIP code patterns", country))
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return derrors.AsError(err, fmt.Sprintf("invalid ZIP code pattern for %s", country))
+		}
+		sr.zipCodes[strings.ToUpper(country)] = compiled
+	}
+	if sr.Password != nil {
+		return sr.Password.LoadDenyList()
+	}
+	return nil
+}
+
+// maxLength returns the maximum length of a field.
+func (sr *SignupRules) maxLength(field string) int {
+	if maxLength, found := sr.MaxLengths[field]; found {
+		return maxLength
+	}
+	return DefaultMaxLengths[field]
+}
+
+// domainMatches checks if the domain of an email is one of the given domains or any of their subdomains.
+func domainMatches(domain string, domains []string) bool {
+	for _, candidate := range domains {
+		candidate = strings.ToLower(strings.TrimPrefix(candidate, "."))
+		if domain == candidate || strings.HasSuffix(domain, "."+candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// emailDomainAllowed checks an email domain against the allowed and denied domains.
+func (sr *SignupRules) emailDomainAllowed(domain string) bool {
+	domain = strings.ToLower(domain)
+	if len(sr.AllowedEmailDomains) > 0 && !domainMatches(domain, sr.AllowedEmailDomains) {
+		return false
+	}
+	return !domainMatches(domain, sr.DeniedEmailDomains)
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nalej/grpc-signup-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// validSignupRequest returns a signup request that follows the default rules.
+func validSignupRequest() *grpc_signup_go.SignupOrganizationRequest {
+	return &grpc_signup_go.SignupOrganizationRequest{
+		OrganizationName:        "acme",
+		OrganizationEmail:       "info@acme.com",
+		OrganizationFullAddress: "Gran Via 1",
+		OrganizationCity:        "Madrid",
+		OrganizationState:       "Madrid",
+		OrganizationCountry:     "ES",
+		OrganizationZipCode:     "28013",
+		OwnerEmail:              "jane@acme.com",
+		OwnerName:               "Jane",
+		OwnerLastName:           "Roe",
+		OwnerTitle:              "CEO",
+		OwnerPassword:           "S3cret-Passw0rd",
+		NalejadminEmail:         "ops@nalej.com",
+		NalejadminName:          "Ops",
+		NalejadminLastName:      "Team",
+		NalejadminTitle:         "Operator",
+		NalejadminPassword:      "An0ther-Passw0rd",
+	}
+}
+
+// validationViolations returns the violations of a request indexed by field.
+func validationViolations(request *grpc_signup_go.SignupOrganizationRequest, rules *SignupRules) map[string]string {
+	err := ValidSignupOrganizationRequest(request, rules)
+	if err == nil {
+		return map[string]string{}
+	}
+	validationErr, ok := err.(*ValidationError)
+	gomega.Expect(ok).To(gomega.BeTrue())
+	violations := make(map[string]string, len(validationErr.Violations))
+	for _, violation := range validationErr.Violations {
+		violations[violation.Field] = violation.Description
+	}
+	return violations
+}
+
+// defaultRules returns the default rules ready to be used.
+func defaultRules() *SignupRules {
+	rules := DefaultSignupRules()
+	gomega.Expect(rules.Validate()).To(gomega.Succeed())
+	return rules
+}
+
+var _ = ginkgo.Describe("Signup rules", func() {
+
+	var request *grpc_signup_go.SignupOrganizationRequest
+	var rules *SignupRules
+
+	ginkgo.BeforeEach(func() {
+		request = validSignupRequest()
+		rules = defaultRules()
+	})
+
+	ginkgo.It("should accept a valid request", func() {
+		gomega.Expect(ValidSignupOrganizationRequest(request, rules)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should report every missing field", func() {
+		request.OrganizationCity = ""
+		request.OwnerTitle = ""
+		request.OrganizationPhotoBase64 = ""
+		violations := validationViolations(request, rules)
+		gomega.Expect(violations).To(gomega.HaveLen(2))
+		gomega.Expect(violations).To(gomega.HaveKeyWithValue("organization_city", "organization_city must be provided"))
+		gomega.Expect(violations).To(gomega.HaveKeyWithValue("owner_title", "owner_title must be provided"))
+	})
+
+	ginkgo.Context("emails", func() {
+		ginkgo.It("should reject invalid addresses", func() {
+			request.OrganizationEmail = "info"
+			request.OwnerEmail = "Jane Roe <jane@acme.com>"
+			request.NalejadminEmail = "ops@"
+			violations := validationViolations(request, rules)
+			gomega.Expect(violations).To(gomega.HaveLen(3))
+			gomega.Expect(violations["owner_email"]).To(gomega.Equal("owner_email must be a valid email address"))
+		})
+
+		ginkgo.It("should only accept the allowed domains and their subdomains", func() {
+			rules.AllowedEmailDomains = []string{"acme.com"}
+			request.OwnerEmail = "jane@eu.acme.com"
+			gomega.Expect(validationViolations(request, rules)).To(gomega.BeEmpty())
+
+			request.OwnerEmail = "jane@notacme.com"
+			violations := validationViolations(request, rules)
+			gomega.Expect(violations).To(gomega.HaveLen(1))
+			gomega.Expect(violations["owner_email"]).To(gomega.Equal("owner_email domain notacme.com is not allowed"))
+		})
+
+		ginkgo.It("should reject the denied domains ignoring case", func() {
+			rules.DeniedEmailDomains = []string{"mailinator.com"}
+			request.OrganizationEmail = "info@MAILINATOR.com"
+			violations := validationViolations(request, rules)
+			gomega.Expect(violations).To(gomega.HaveLen(1))
+			gomega.Expect(violations).To(gomega.HaveKey("organization_email"))
+		})
+
+		ginkgo.It("should not apply the domain rules to the Nalej administrator", func() {
+			rules.AllowedEmailDomains = []string{"acme.com"}
+			gomega.Expect(validationViolations(request, rules)).NotTo(gomega.HaveKey("nalejadmin_email"))
+		})
+	})
+
+	ginkgo.Context("country and ZIP code", func() {
+		ginkgo.It("should reject unknown countries", func() {
+			request.OrganizationCountry = "Unknown"
+			violations := validationViolations(request, rules)
+			gomega.Expect(violations).To(gomega.HaveLen(1))
+			gomega.Expect(violations["organization_country"]).To(gomega.ContainSubstring("ISO 3166-1 alpha-2"))
+		})
+
+		ginkgo.It("should accept lowercase country codes", func() {
+			request.OrganizationCountry = "es"
+			gomega.Expect(validationViolations(request, rules)).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should check the ZIP code format of the country", func() {
+			request.OrganizationZipCode = "2801"
+			violations := validationViolations(request, rules)
+			gomega.Expect(violations["organization_zip_code"]).To(gomega.Equal("organization_zip_code is not a valid ZIP code of ES"))
+
+			request.OrganizationCountry = "US"
+			request.OrganizationZipCode = "94105-1234"
+			gomega.Expect(validationViolations(request, rules)).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should accept any ZIP code of the countries without a format", func() {
+			request.OrganizationCountry = "AD"
+			request.OrganizationZipCode = "AD500"
+			gomega.Expect(validationViolations(request, rules)).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should not check the country if it is disabled", func() {
+			rules.ValidateCountry = false
+			request.OrganizationCountry = "Unknown"
+			request.OrganizationZipCode = "Unknown"
+			gomega.Expect(validationViolations(request, rules)).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("maximum lengths", func() {
+		ginkgo.It("should reject fields longer than their limit", func() {
+			request.OrganizationName = strings.Repeat("a", DefaultMaxLengths["organization_name"]+1)
+			violations := validationViolations(request, rules)
+			gomega.Expect(violations["organization_name"]).To(gomega.Equal("organization_name cannot be longer than 128 characters"))
+		})
+
+		ginkgo.It("should count characters instead of bytes", func() {
+			request.OrganizationName = strings.Repeat("ñ", DefaultMaxLengths["organization_name"])
+			gomega.Expect(validationViolations(request, rules)).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should report only the first violation of a field", func() {
+			request.OwnerEmail = strings.Repeat("a", DefaultMaxLengths["owner_email"]) + "@acme.com"
+			violations := validationViolations(request, rules)
+			gomega.Expect(violations["owner_email"]).To(gomega.ContainSubstring("cannot be longer than"))
+		})
+	})
+
+	ginkgo.Context("validating the rules", func() {
+		ginkgo.It("should reject invalid domains", func() {
+			rules.DeniedEmailDomains = []string{"user@mailinator.com"}
+			gomega.Expect(rules.Validate()).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject unknown fields and non positive lengths", func() {
+			rules.MaxLengths = map[string]int{"unknown_field": 10}
+			gomega.Expect(rules.Validate()).NotTo(gomega.Succeed())
+			rules.MaxLengths = map[string]int{"organization_name": 0}
+			gomega.Expect(rules.Validate()).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject invalid ZIP code patterns", func() {
+			rules.ZipCodePatterns = map[string]string{"XX": `^\d+$`}
+			gomega.Expect(rules.Validate()).NotTo(gomega.Succeed())
+			rules.ZipCodePatterns = map[string]string{"ES": `^(\d+$`}
+			gomega.Expect(rules.Validate()).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("loading the rules", func() {
+		var dir string
+
+		ginkgo.BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "signup-rules")
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+
+		ginkgo.AfterEach(func() {
+			gomega.Expect(os.RemoveAll(dir)).To(gomega.Succeed())
+		})
+
+		writeRules := func(name string, content string) string {
+			path := filepath.Join(dir, name)
+			gomega.Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(gomega.Succeed())
+			return path
+		}
+
+		ginkgo.It("should override the defaults with a YAML file", func() {
+			path := writeRules("rules.yaml", `
+deniedEmailDomains: [acme.com]
+validateCountry: true
+zipCodePatterns:
+  ES: '^\d{3}$'
+maxLengths:
+  organization_name: 3
+`)
+			loaded, err := LoadSignupRules(path)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(loaded.maxLength("organization_name")).To(gomega.Equal(3))
+			gomega.Expect(loaded.maxLength("organization_city")).To(gomega.Equal(DefaultMaxLengths["organization_city"]))
+			gomega.Expect(loaded.ZipCodePatterns).To(gomega.HaveLen(1))
+
+			violations := validationViolations(request, loaded)
+			gomega.Expect(violations).To(gomega.HaveKey("organization_name"))
+			gomega.Expect(violations).To(gomega.HaveKey("organization_email"))
+			gomega.Expect(violations).To(gomega.HaveKey("owner_email"))
+			gomega.Expect(violations).To(gomega.HaveKey("organization_zip_code"))
+		})
+
+		ginkgo.It("should keep the default ZIP code patterns if the file does not set them", func() {
+			path := writeRules("rules.json", `{"validateCountry": false}`)
+			loaded, err := LoadSignupRules(path)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(loaded.ValidateCountry).To(gomega.BeFalse())
+			gomega.Expect(loaded.ZipCodePatterns).To(gomega.HaveLen(len(DefaultZipCodePatterns)))
+		})
+
+		ginkgo.It("should reject unknown keys in YAML files", func() {
+			path := writeRules("rules.yaml", "validateCountries: true\n")
+			_, err := LoadSignupRules(path)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject invalid rules", func() {
+			path := writeRules("rules.yaml", "maxLengths: {organization_name: -1}\n")
+			_, err := LoadSignupRules(path)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+})
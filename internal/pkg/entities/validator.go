@@ -17,6 +17,11 @@
 package entities
 
 import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-organization-go"
 	"github.com/nalej/grpc-signup-go"
@@ -29,57 +34,125 @@ func ValidOrganizationId(organizationID *grpc_organization_go.OrganizationId) de
 	return nil
 }
 
-func ValidSignupOrganizationRequest(signupRequest *grpc_signup_go.SignupOrganizationRequest) derrors.Error {
-	if signupRequest.OrganizationName == "" {
-		return derrors.NewInvalidArgumentError("organization_name must be provided")
-	}
-	if signupRequest.OrganizationEmail == "" {
-		return derrors.NewInvalidArgumentError("organization_email must be provided")
-	}
-	if signupRequest.OrganizationFullAddress == "" {
-		return derrors.NewInvalidArgumentError("organization_full_address must be provided")
-	}
-	if signupRequest.OrganizationCity == "" {
-		return derrors.NewInvalidArgumentError("organization_city must be provided")
-	}
-	if signupRequest.OrganizationState == "" {
-		return derrors.NewInvalidArgumentError("organization_state must be provided")
-	}
-	if signupRequest.OrganizationCountry == "" {
-		return derrors.NewInvalidArgumentError("organization_country must be provided")
-	}
-	if signupRequest.OrganizationZipCode == "" {
-		return derrors.NewInvalidArgumentError("organization_zip_code must be provided")
-	}
-	if signupRequest.OwnerEmail == "" {
-		return derrors.NewInvalidArgumentError("owner_email must be provided")
-	}
-	if signupRequest.OwnerName == "" {
-		return derrors.NewInvalidArgumentError("owner_name must be provided")
-	}
-	if signupRequest.OwnerLastName == "" {
-		return derrors.NewInvalidArgumentError("owner_last_name must be provided")
-	}
-	if signupRequest.OwnerTitle == "" {
-		return derrors.NewInvalidArgumentError("owner_title must be provided")
-	}
-	if signupRequest.OwnerPassword == "" {
-		return derrors.NewInvalidArgumentError("owner_password must be provided")
+// signupField contains the name and value of a field of a signup request.
+type signupField struct {
+	name     string
+	value    string
+	optional bool
+}
+
+// signupFields returns the fields of a signup request in the order they are validated.
+func signupFields(signupRequest *grpc_signup_go.SignupOrganizationRequest) []signupField {
+	return []signupField{
+		{name: "organization_name", value: signupRequest.OrganizationName},
+		{name: "organization_email", value: signupRequest.OrganizationEmail},
+		{name: "organization_full_address", value: signupRequest.OrganizationFullAddress},
+		{name: "organization_city", value: signupRequest.OrganizationCity},
+		{name: "organization_state", value: signupRequest.OrganizationState},
+		{name: "organization_country", value: signupRequest.OrganizationCountry},
+		{name: "organization_zip_code", value: signupRequest.OrganizationZipCode},
+		{name: "organization_photo_base64", value: signupRequest.OrganizationPhotoBase64, optional: true},
+		{name: "owner_email", value: signupRequest.OwnerEmail},
+		{name: "owner_name", value: signupRequest.OwnerName},
+		{name: "owner_last_name", value: signupRequest.OwnerLastName},
+		{name: "owner_title", value: signupRequest.OwnerTitle},
+		{name: "owner_password", value: signupRequest.OwnerPassword},
+		{name: "nalejadmin_email", value: signupRequest.NalejadminEmail},
+		{name: "nalejadmin_name", value: signupRequest.NalejadminName},
+		{name: "nalejadmin_last_name", value: signupRequest.NalejadminLastName},
+		{name: "nalejadmin_title", value: signupRequest.NalejadminTitle},
+		{name: "nalejadmin_password", value: signupRequest.NalejadminPassword},
 	}
-	if signupRequest.NalejadminEmail == "" {
-		return derrors.NewInvalidArgumentError("nalejadmin_email must be provided")
+}
+
+// emailViolation checks that an email is a bare RFC 5322 address, and optionally that its domain is allowed. It
+// returns a description of the violation, or an empty string if the email is valid.
+func emailViolation(field string, email string, rules *SignupRules, checkDomain bool) string {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return fmt.Sprintf("%s must be a valid email address", field)
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if checkDomain && !rules.emailDomainAllowed(domain) {
+		return fmt.Sprintf("%s domain %s is not allowed", field, domain)
+	}
+	return ""
+}
+
+// ValidSignupOrganizationRequest checks that the required fields of a signup request are provided and follow the
+// signup rules, and that the passwords follow the password policy. The domain rules are not applied to the email of
+// the Nalej administrator. Every violation is reported in the returned ValidationError.
+func ValidSignupOrganizationRequest(signupRequest *grpc_signup_go.SignupOrganizationRequest, rules *SignupRules) derrors.Error {
+	violations := make([]FieldViolation, 0)
+	// invalid contains the fields already reported so only their first violation is included.
+	invalid := make(map[string]bool, 0)
+	add := func(field string, description string) {
+		if description != "" && !invalid[field] {
+			invalid[field] = true
+			violations = append(violations, FieldViolation{Field: field, Description: description})
+		}
+	}
+	for _, field := range signupFields(signupRequest) {
+		if field.value == "" {
+			if !field.optional {
+				add(field.name, fmt.Sprintf("%s must be provided", field.name))
+			}
+			continue
+		}
+		if maxLength := rules.maxLength(field.name); utf8.RuneCountInString(field.value) > maxLength {
+			add(field.name, fmt.Sprintf("%s cannot be longer than %d characters", field.name, maxLength))
+		}
+	}
+	if !invalid["organization_email"] {
+		add("organization_email", emailViolation("organization_email", signupRequest.OrganizationEmail, rules, true))
+	}
+	if !invalid["owner_email"] {
+		add("owner_email", emailViolation("owner_email", signupRequest.OwnerEmail, rules, true))
+	}
+	if !invalid["nalejadmin_email"] {
+		add("nalejadmin_email", emailViolation("nalejadmin_email", signupRequest.NalejadminEmail, rules, false))
+	}
+	if rules.ValidateCountry && !invalid["organization_country"] {
+		country := strings.ToUpper(signupRequest.OrganizationCountry)
+		if !countryCodes[country] {
+			add("organization_country", "organization_country must be an ISO 3166-1 alpha-2 code")
+		} else if pattern, found := rules.zipCodes[country]; found && !invalid["organization_zip_code"] &&
+			!pattern.MatchString(signupRequest.OrganizationZipCode) {
+			add("organization_zip_code", fmt.Sprintf("organization_zip_code is not a valid ZIP code of %s", country))
+		}
+	}
+	if rules.Password != nil {
+		if !invalid["owner_password"] {
+			personal := personalInfo(signupRequest.OwnerEmail, signupRequest.OwnerName, signupRequest.OwnerLastName)
+			add("owner_password", rules.Password.violation("owner_password", signupRequest.OwnerPassword, personal))
+		}
+		if !invalid["nalejadmin_password"] {
+			personal := personalInfo(signupRequest.NalejadminEmail, signupRequest.NalejadminName, signupRequest.NalejadminLastName)
+			add("nalejadmin_password", rules.Password.violation("nalejadmin_password", signupRequest.NalejadminPassword, personal))
+		}
+	}
+	return newValidationError(violations)
+}
+
+func ValidSignupJobRequest(request *grpc_signup_go.SignupJobRequest) derrors.Error {
+	if request.JobId == "" {
+		return derrors.NewInvalidArgumentError("job_id must be provided")
 	}
-	if signupRequest.NalejadminName == "" {
-		return derrors.NewInvalidArgumentError("nalejadmin_name must be provided")
+	return nil
+}
+
+func ValidListOrganizationsRequest(request *grpc_signup_go.SignupInfoRequest) derrors.Error {
+	if request.PageSize < 0 {
+		return derrors.NewInvalidArgumentError("page_size cannot be negative")
 	}
-	if signupRequest.NalejadminLastName == "" {
-		return derrors.NewInvalidArgumentError("nalejadmin_last_name must be provided")
+	if _, known := grpc_signup_go.OrganizationSortKey_name[int32(request.SortBy)]; !known {
+		return derrors.NewInvalidArgumentError("unknown sort_by")
 	}
-	if signupRequest.NalejadminTitle == "" {
-		return derrors.NewInvalidArgumentError("nalejadmin_title must be provided")
+	if _, known := grpc_signup_go.ClusterFilter_name[int32(request.HasClusters)]; !known {
+		return derrors.NewInvalidArgumentError("unknown has_clusters")
 	}
-	if signupRequest.NalejadminPassword == "" {
-		return derrors.NewInvalidArgumentError("nalejadmin_password must be provided")
+	if request.CreatedAfter != 0 && request.CreatedBefore != 0 && request.CreatedAfter >= request.CreatedBefore {
+		return derrors.NewInvalidArgumentError("created_after must be before created_before")
 	}
 	return nil
 }
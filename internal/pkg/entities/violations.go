@@ -0,0 +1,79 @@
+/*
+ * Copyright 2020 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FieldViolation describes why a field of a request is not valid.
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// invalidArgument is the error embedded in a ValidationError. The alias avoids embedding a field named Error, that
+// would hide the Error method.
+type invalidArgument = derrors.Error
+
+// ValidationError contains every violation found validating a request. It behaves as an InvalidArgument
+// derrors.Error, and it is sent to gRPC clients as a status with the violations as BadRequest details.
+type ValidationError struct {
+	invalidArgument
+	Violations []FieldViolation
+}
+
+// newValidationError returns an error with the given violations, or nil if there are none.
+func newValidationError(violations []FieldViolation) derrors.Error {
+	if len(violations) == 0 {
+		return nil
+	}
+	descriptions := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		descriptions = append(descriptions, violation.Description)
+	}
+	msg := fmt.Sprintf("invalid request: %s", strings.Join(descriptions, "; "))
+	return &ValidationError{
+		invalidArgument: derrors.NewInvalidArgumentError(msg),
+		Violations:      violations,
+	}
+}
+
+// GRPCStatus returns the InvalidArgument status of the error with the violations as BadRequest details.
+func (ve *ValidationError) GRPCStatus() *status.Status {
+	st := status.New(codes.InvalidArgument, ve.Error())
+	badRequest := &errdetails.BadRequest{
+		FieldViolations: make([]*errdetails.BadRequest_FieldViolation, 0, len(ve.Violations)),
+	}
+	for _, violation := range ve.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       violation.Field,
+			Description: violation.Description,
+		})
+	}
+	detailed, err := st.WithDetails(badRequest)
+	if err != nil {
+		return st
+	}
+	return detailed
+}